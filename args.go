@@ -0,0 +1,51 @@
+package envflag
+
+import (
+	"flag"
+	"strings"
+)
+
+// scanArgs returns the raw values given for flags in the argument list,
+// following the syntax of the flag package without setting any values.
+// If a flag is given more than once, its last value is returned. Scanning
+// stops at the first non-flag argument, at "--", or at an undefined flag.
+func scanArgs(set *flag.FlagSet, args []string) map[string]string {
+	raw := make(map[string]string)
+	for len(args) > 0 {
+		s := args[0]
+		if len(s) < 2 || s[0] != '-' {
+			break
+		}
+		numMinuses := 1
+		if s[1] == '-' {
+			numMinuses++
+			if len(s) == 2 {
+				break
+			}
+		}
+		name := s[numMinuses:]
+		if len(name) == 0 || name[0] == '-' || name[0] == '=' {
+			break
+		}
+		args = args[1:]
+		value, hasValue := "", false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+		f := set.Lookup(name)
+		if f == nil {
+			break
+		}
+		if !hasValue {
+			if isBoolFlag(f.Value) {
+				value = "true"
+			} else if len(args) > 0 {
+				value, args = args[0], args[1:]
+			} else {
+				break
+			}
+		}
+		raw[name] = value
+	}
+	return raw
+}
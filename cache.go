@@ -0,0 +1,67 @@
+package envflag
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// An EnvCache is a snapshot of the environment which can be shared by
+// multiple calls to Parse, so that the environment is read only once.
+// The snapshot is taken on first use and kept until it is invalidated.
+// The zero value is ready to use. An EnvCache is safe for concurrent use
+// by multiple goroutines, including concurrent calls to Parse.
+type EnvCache struct {
+	mu  sync.RWMutex
+	env map[string]string
+}
+
+// Invalidate discards the snapshot, so that the environment is read again
+// on next use. It may be called while the cache is in use, such as when
+// reloading configuration.
+func (c *EnvCache) Invalidate() {
+	c.mu.Lock()
+	c.env = nil
+	c.mu.Unlock()
+}
+
+func (c *EnvCache) lookup(key string) (string, bool) {
+	v, ok := c.snapshot()[key]
+	return v, ok
+}
+
+// snapshot returns the snapshot of the environment, taking it if necessary.
+// It must not be modified.
+func (c *EnvCache) snapshot() map[string]string {
+	c.mu.RLock()
+	env := c.env
+	c.mu.RUnlock()
+	if env == nil {
+		c.mu.Lock()
+		if c.env == nil {
+			c.env = environ()
+		}
+		env = c.env
+		c.mu.Unlock()
+	}
+	return env
+}
+
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// Cache returns an Option which specifies a cache from which to read the
+// environment. If unused, the environment is read directly on every Parse.
+func Cache(c *EnvCache) Option {
+	return func(o *option) {
+		o.lookup = c.lookup
+		o.environ = c.snapshot
+	}
+}
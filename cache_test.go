@@ -0,0 +1,68 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=1"})
+	var c EnvCache
+	parse := func() int {
+		set := flag.NewFlagSet("cache", flag.ContinueOnError)
+		a := set.Int("a", 0, "")
+		if err := Parse(FlagSet(set), Args(nil), Cache(&c)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return *a
+	}
+	if got := parse(); got != 1 {
+		t.Fatalf("want: 1; got: %d", got)
+	}
+	setEnv([]string{"A=2"})
+	if got := parse(); got != 1 {
+		t.Fatalf("cached: want: 1; got: %d", got)
+	}
+	c.Invalidate()
+	if got := parse(); got != 2 {
+		t.Fatalf("invalidated: want: 2; got: %d", got)
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	defer resetEnv()()
+	var env []string
+	sets := make([]*flag.FlagSet, 3)
+	for i := range sets {
+		sets[i] = flag.NewFlagSet(fmt.Sprint("set", i), flag.ContinueOnError)
+		sets[i].SetOutput(bytes.NewBuffer(nil))
+		for j := 0; j < 50; j++ {
+			name := fmt.Sprintf("set%d_flag%d", i, j)
+			sets[i].String(name, "", "")
+			if j%2 == 0 {
+				env = append(env, fmt.Sprintf("SET%d_FLAG%d=value", i, j))
+			}
+		}
+	}
+	setEnv(env)
+	bench := func(b *testing.B, opts func() []Option) {
+		for n := 0; n < b.N; n++ {
+			o := opts()
+			for _, set := range sets {
+				if err := Parse(append(o, FlagSet(set), Args(nil))...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	b.Run("uncached", func(b *testing.B) {
+		bench(b, func() []Option { return nil })
+	})
+	b.Run("cached", func(b *testing.B) {
+		var c EnvCache
+		bench(b, func() []Option { return []Option{Cache(&c)} })
+	})
+}
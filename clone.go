@@ -0,0 +1,187 @@
+package envflag
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// newValues constructs zero values of the types defined by the flag package,
+// keyed by their dynamic type names.
+var newValues = map[string]func(*flag.FlagSet) flag.Value{
+	"*flag.boolValue":     func(s *flag.FlagSet) flag.Value { s.Bool("v", false, ""); return s.Lookup("v").Value },
+	"*flag.intValue":      func(s *flag.FlagSet) flag.Value { s.Int("v", 0, ""); return s.Lookup("v").Value },
+	"*flag.int64Value":    func(s *flag.FlagSet) flag.Value { s.Int64("v", 0, ""); return s.Lookup("v").Value },
+	"*flag.uintValue":     func(s *flag.FlagSet) flag.Value { s.Uint("v", 0, ""); return s.Lookup("v").Value },
+	"*flag.uint64Value":   func(s *flag.FlagSet) flag.Value { s.Uint64("v", 0, ""); return s.Lookup("v").Value },
+	"*flag.stringValue":   func(s *flag.FlagSet) flag.Value { s.String("v", "", ""); return s.Lookup("v").Value },
+	"*flag.float64Value":  func(s *flag.FlagSet) flag.Value { s.Float64("v", 0, ""); return s.Lookup("v").Value },
+	"*flag.durationValue": func(s *flag.FlagSet) flag.Value { s.Duration("v", time.Duration(0), ""); return s.Lookup("v").Value },
+}
+
+// newValue returns a new value of the same type as v, if v is of a type
+// defined by the flag package. Values of other types cannot be cloned, since
+// nothing is known about how they store their state.
+func newValue(v flag.Value) (flag.Value, bool) {
+	fn, ok := newValues[reflect.TypeOf(v).String()]
+	if !ok {
+		return nil, false
+	}
+	return fn(flag.NewFlagSet("", flag.ContinueOnError)), true
+}
+
+// cloneSet returns a new FlagSet with the same name as set and a copy of each
+// of its flags whose value can be cloned. The copies are given their default
+// values and are not marked as set. Output is discarded.
+func cloneSet(set *flag.FlagSet) *flag.FlagSet {
+	clone := flag.NewFlagSet(set.Name(), flag.ContinueOnError)
+	clone.SetOutput(io.Discard)
+	set.VisitAll(func(f *flag.Flag) {
+		v, ok := newValue(f.Value)
+		if !ok || v.Set(f.DefValue) != nil {
+			return
+		}
+		clone.Var(v, f.Name, f.Usage)
+	})
+	return clone
+}
+
+// captureSet returns a new FlagSet like cloneSet, but in which flags whose
+// values cannot be cloned are replaced by values which capture the strings
+// passed to their Set methods.
+func captureSet(set *flag.FlagSet) *flag.FlagSet {
+	clone := flag.NewFlagSet(set.Name(), flag.ContinueOnError)
+	clone.SetOutput(io.Discard)
+	set.VisitAll(func(f *flag.Flag) {
+		v, ok := newValue(f.Value)
+		if !ok || v.Set(f.DefValue) != nil {
+			v = &capturedValue{def: f.DefValue, bool: isBoolFlag(f.Value)}
+		}
+		clone.Var(v, f.Name, f.Usage)
+		clone.Lookup(f.Name).DefValue = f.DefValue
+	})
+	return clone
+}
+
+// A capturedValue stands in for a value which cannot be cloned, capturing
+// the strings passed to its Set method without interpreting them.
+type capturedValue struct {
+	def    string
+	bool   bool
+	values []string
+}
+
+func (v *capturedValue) String() string {
+	if v.values == nil {
+		return v.def
+	}
+	return strings.Join(v.values, ",")
+}
+
+func (v *capturedValue) Set(s string) error {
+	v.values = append(v.values, s)
+	return nil
+}
+
+func (v *capturedValue) IsBoolFlag() bool { return v.bool }
+
+// DryRun resolves the flags as Parse would with the given options, but into a
+// copy of the FlagSet, leaving the flags unchanged, and returns the Result,
+// including the value each flag would be set to, and any error, such as for
+// an invalid value or a failed validation, as for a command which checks the
+// configuration before it's applied. Options which act on the resolved flags,
+// such as AfterSet, ProvenanceFile, and Watch, have no effect.
+//
+// Flags of the types defined by the flag package are copied with their
+// default values, so their values are parsed as usual. Since nothing is known
+// about how values of other types store their state, they are replaced in the
+// copy by values which accept any string passed to their Set methods, so
+// their invalid values aren't detected, and their values in the Result are the
+// strings which would be passed to Set, separated by commas, or the flags'
+// default values if Set wouldn't be called.
+func DryRun(options ...Option) (*Result, error) {
+	o := &option{set: flag.CommandLine}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	// Secret values are replaced in the copy, so their flags are redacted by
+	// name instead.
+	var secrets []string
+	o.set.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*Secret); ok {
+			secrets = append(secrets, f.Name)
+		}
+	})
+	options = append(options[:len(options):len(options)], FlagSet(captureSet(o.set)), Redact(secrets...), dryRun(), func(o *option) {
+		o.consulted = make(map[string]bool)
+	})
+	return parseContext(context.Background(), nil, options)
+}
+
+// ParseInto resolves the flags of set as Parse would with the given options,
+// but into a copy of set, which it returns, leaving set unchanged. Values are
+// read by calling lookup with ctx in place of the process environment, so a
+// multi-tenant server can derive isolated configuration per request from
+// tenant-scoped values. Since lookup cannot enumerate values, EnvMap has no
+// effect. The argument list is empty unless given by Args.
+//
+// The copy is made by reconstructing each flag with its name, usage, and
+// default value. Only flags of the types defined by the flag package, such
+// as those defined by FlagSet.Int and FlagSet.Duration, can be reconstructed,
+// since nothing is known about how other flag.Value types store their state;
+// flags of other types, including those defined by FlagSet.Var, FlagSet.Func,
+// and FlagSet.TextVar, are omitted from the copy.
+func ParseInto(ctx context.Context, set *flag.FlagSet, lookup func(ctx context.Context, key string) (string, bool), options ...Option) (*flag.FlagSet, error) {
+	clone := cloneSet(set)
+	options = append([]Option{Args(nil)}, options...)
+	options = append(options, FlagSet(clone), func(o *option) {
+		o.lookup = func(key string) (string, bool) { return lookup(ctx, key) }
+		o.environ = func() map[string]string { return nil }
+	})
+	if err := ParseContext(ctx, options...); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Reset restores each flag of set to its default value by calling its Set
+// method with the default value's string form, and returns a new FlagSet with
+// the same name, error handling mode, output, usage function, and flags,
+// sharing their values, so that they can be parsed again from a clean state,
+// such as in a table-driven test or a reloader. The usage function is copied
+// without the wrapper installed by options such as AnnotateUsage, which the
+// next Parse installs again. A new FlagSet is required
+// because a FlagSet records which of its flags have been set, such as by the
+// argument list, and the record cannot be cleared; set should no longer be
+// used. For example:
+//
+//	flag.CommandLine, err = envflag.Reset(flag.CommandLine)
+//
+// Reset is only correct for flags whose Set methods replace their values, as
+// do those of the types defined by the flag package. A flag whose Set method
+// accumulates values, such as a list, gains its default value as another
+// element instead. A flag whose Set method rejects the default value, such as
+// one defined by FlagSet.Func, causes Reset to fail, and the error lists the
+// flags which could not be restored, though the returned FlagSet is usable.
+func Reset(set *flag.FlagSet) (*flag.FlagSet, error) {
+	reset := flag.NewFlagSet(set.Name(), set.ErrorHandling())
+	reset.SetOutput(set.Output())
+	reset.Usage = unwrapUsage(set)
+	var errs []error
+	set.VisitAll(func(f *flag.Flag) {
+		if err := f.Value.Set(f.DefValue); err != nil {
+			errs = append(errs, fmt.Errorf("envflag: resetting flag -%s: %v", f.Name, err))
+		}
+		reset.Var(f.Value, f.Name, f.Usage)
+		reset.Lookup(f.Name).DefValue = f.DefValue
+	})
+	return reset, errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package envflag
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]func(string) (string, error){
+		"base64": func(s string) (string, error) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			return string(b), err
+		},
+		"hex": func(s string) (string, error) {
+			b, err := hex.DecodeString(s)
+			return string(b), err
+		},
+	}
+)
+
+// RegisterCodec makes a decoder available by name for use with Codec.
+// The codecs "base64" (standard encoding) and "hex" are built in.
+// If RegisterCodec is called twice with the same name or if decode is nil,
+// it panics.
+func RegisterCodec(name string, decode func(string) (string, error)) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if decode == nil {
+		panic("envflag: RegisterCodec decoder is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic("envflag: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = decode
+}
+
+// Codec returns an Option which decodes the environment variable values of
+// the named flag with the registered codec before they are used. Parse fails
+// if the codec is not registered or a value cannot be decoded. Values passed
+// as command line flags are not decoded.
+func Codec(flagName, codecName string) Option {
+	return func(o *option) {
+		codecsMu.RLock()
+		decode, ok := codecs[codecName]
+		codecsMu.RUnlock()
+		if !ok {
+			if o.err == nil {
+				o.err = fmt.Errorf("envflag: flag -%s: unknown codec %q", flagName, codecName)
+			}
+			return
+		}
+		if o.codecs == nil {
+			o.codecs = make(map[string]codec)
+		}
+		o.codecs[flagName] = codec{codecName, decode}
+	}
+}
+
+type codec struct {
+	name   string
+	decode func(string) (string, error)
+}
@@ -0,0 +1,47 @@
+package envflag
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	defer resetEnv()()
+	RegisterCodec("test_upper", func(s string) (string, error) {
+		if s == "" {
+			return "", errors.New("empty")
+		}
+		return strings.ToUpper(s), nil
+	})
+	setEnv([]string{"B64=c2VjcmV0", "HEX=68657821", "UPPER=loud", "EMPTY="})
+	set := flag.NewFlagSet("codec", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	b64 := set.String("b64", "", "")
+	hex := set.String("hex", "", "")
+	upper := set.String("upper", "", "")
+	arg := set.String("arg", "", "")
+	err := Parse(FlagSet(set), Args([]string{"--arg=Zm9v"}),
+		Codec("b64", "base64"),
+		Codec("hex", "hex"),
+		Codec("upper", "test_upper"),
+		Codec("arg", "base64"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *b64 != "secret" || *hex != "hex!" || *upper != "LOUD" || *arg != "Zm9v" {
+		t.Errorf("unexpected values: b64=%q hex=%q upper=%q arg=%q", *b64, *hex, *upper, *arg)
+	}
+
+	set = flag.NewFlagSet("codec", flag.ContinueOnError)
+	set.String("empty", "", "")
+	if err := Parse(FlagSet(set), Args(nil), Codec("empty", "test_upper")); err == nil {
+		t.Error("decode: expected error")
+	}
+	if err := Parse(FlagSet(set), Args(nil), Codec("empty", "rot13")); err == nil {
+		t.Error("unknown codec: expected error")
+	}
+}
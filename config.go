@@ -0,0 +1,59 @@
+package envflag
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfigFile returns an Option which loads values for flags from a file at
+// path in a format decoded by decode, such as TOML, so that packages such as
+// envtoml can add formats without envflag depending on their decoders. The
+// decoder returns values keyed by flag name, with each value of a flag passed
+// to its Set method in turn, as for SplitValues. Its values are used only if
+// neither the argument list, the environment, nor a file given to JSONFile has
+// a value for a flag, but before the flag's default value. Names which don't
+// name a defined flag are ignored. If the file does not exist, the option has
+// no effect; if it cannot be decoded, Parse fails. The values of a later file
+// replace those of an earlier one.
+func ConfigFile(path string, decode func([]byte) (map[string][]string, error)) Option {
+	return func(o *option) {
+		o.configFiles = append(o.configFiles, configFile{path, decode})
+	}
+}
+
+type configFile struct {
+	path   string
+	decode func([]byte) (map[string][]string, error)
+}
+
+func (o *option) loadConfigFiles() error {
+	for _, cf := range o.configFiles {
+		b, err := o.readFile(cf.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("envflag: %w", err)
+		}
+		values, err := cf.decode(b)
+		if err != nil {
+			return fmt.Errorf("envflag: %s: %v", cf.path, err)
+		}
+		if o.configValues == nil {
+			o.configValues = make(map[string][]string)
+		}
+		for k, v := range values {
+			o.configValues[k] = v
+		}
+	}
+	return nil
+}
+
+// configValue returns the value for the named flag from files given to
+// ConfigFile.
+func (o *option) configValue(name string) (string, bool) {
+	values, ok := o.configValues[name]
+	return strings.Join(values, ","), ok
+}
@@ -0,0 +1,69 @@
+package envflag
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeLines decodes lines of the form name=value, repeating a name to give
+// it several values.
+func decodeLines(b []byte) (map[string][]string, error) {
+	values := make(map[string][]string)
+	for _, line := range strings.Fields(string(b)) {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.New("missing '='")
+		}
+		values[name] = append(values[name], value)
+	}
+	return values, nil
+}
+
+func TestConfigFile(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"HOST=env"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	jsonPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("host=config port=1 name=config tags=a tags=b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(`{"name": "json"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("config", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	host := set.String("host", "", "")
+	port := set.Int("port", 0, "")
+	name := set.String("name", "", "")
+	var tags stringList
+	set.Var(&tags, "tags", "")
+	res, err := ParseWithResult(FlagSet(set), Args(nil), JSONFile(jsonPath),
+		ConfigFile(filepath.Join(dir, "missing"), decodeLines), ConfigFile(path, decodeLines))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *host != "env" || *port != 1 || *name != "json" {
+		t.Errorf("unexpected values: host=%q port=%d name=%q", *host, *port, *name)
+	}
+	if want := (stringList{"a", "b"}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags: want: %q; got: %q", want, tags)
+	}
+	if got := res.Sources["port"]; got != SourceConfig {
+		t.Errorf("source: want: %v; got: %v", SourceConfig, got)
+	}
+
+	if err := os.WriteFile(path, []byte("port"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = Parse(FlagSet(flag.NewFlagSet("config", flag.ContinueOnError)), Args(nil), ConfigFile(path, decodeLines))
+	if want := "envflag: " + path + ": missing '='"; err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+}
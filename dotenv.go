@@ -0,0 +1,288 @@
+package envflag
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A DupePolicy specifies how a key defined more than once in a file is handled.
+type DupePolicy int
+
+// Duplicate key policies.
+const (
+	LastWins  DupePolicy = iota // the last definition is used, as in a shell
+	FirstWins                   // the first definition is used
+	DupeError                   // loading the file fails
+)
+
+// DuplicateKeyPolicy returns an Option which specifies how keys defined more
+// than once in a file given to EnvFile are handled. If unused, LastWins is
+// the default, matching the semantics of sourcing the file in a shell.
+func DuplicateKeyPolicy(policy DupePolicy) Option {
+	return func(o *option) {
+		o.dupePolicy = policy
+	}
+}
+
+// EnvFile returns an Option which loads environment variables from a file
+// at path, such as a .env file shipped alongside the binary. Variables in the
+// file are consulted for keys that are not present in the process environment,
+// so the precedence is: command line flags, the process environment, the file,
+// and then default values. If given more than once, later files take precedence
+// over earlier ones. A missing file is ignored; use MustEnvFile to require it.
+//
+// Each line of the file is blank, a comment beginning with "#", or an
+// assignment of the form KEY=VALUE, optionally preceded by "export". A value
+// may be enclosed in single quotes, which preserve it literally, or in double
+// quotes, which allow the escapes \n, \r, \t, \", and \\. A quoted value may
+// span several lines, and "#" within it doesn't begin a comment. An unquoted
+// value is trimmed of whitespace and of any comment beginning with " #". Lines
+// may end with "\r\n", as in a file written on Windows. ParseDotenv parses the
+// same format.
+func EnvFile(path string) Option {
+	return func(o *option) {
+		o.envFiles = append(o.envFiles, envFile{path: path})
+	}
+}
+
+// MustEnvFile returns an Option like EnvFile, but which causes Parse to fail
+// if the file does not exist.
+func MustEnvFile(path string) Option {
+	return func(o *option) {
+		o.envFiles = append(o.envFiles, envFile{path: path, must: true})
+	}
+}
+
+// EnvReader returns an Option which loads environment variables from r, in
+// the format of a file given to EnvFile, such as configuration held in memory
+// or streamed from a pipe or network. The variables are layered with those of
+// files given to EnvFile in the order of their options. The first Parse given
+// the option reads r to its end, and later ones, such as those of Watch and
+// WatchSignal, reuse what it read.
+func EnvReader(r io.Reader) Option {
+	er := &envReader{r: r}
+	return func(o *option) {
+		o.envFiles = append(o.envFiles, envFile{r: er})
+	}
+}
+
+type envFile struct {
+	path string
+	must bool
+	r    *envReader
+}
+
+// An envReader reads its reader once and keeps what it read.
+type envReader struct {
+	r    io.Reader
+	once sync.Once
+	b    []byte
+	err  error
+}
+
+func (er *envReader) read() ([]byte, error) {
+	er.once.Do(func() { er.b, er.err = io.ReadAll(er.r) })
+	return er.b, er.err
+}
+
+func (o *option) loadEnvFiles() error {
+	for _, ef := range o.envFiles {
+		if ef.r != nil {
+			b, err := ef.r.read()
+			if err != nil {
+				return fmt.Errorf("envflag: reader: %v", err)
+			}
+			env, err := parseDotenv(bytes.NewReader(b), o.dupePolicy)
+			if err != nil {
+				return fmt.Errorf("envflag: reader: %v", err)
+			}
+			o.addFileEnv(env)
+			continue
+		}
+		path := ef.path
+		b, err := o.readFile(path)
+		if errors.Is(err, os.ErrNotExist) && !ef.must {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("envflag: %w", err)
+		}
+		env, err := parseDotenv(bytes.NewReader(b), o.dupePolicy)
+		if err != nil {
+			return fmt.Errorf("envflag: %s: %v", path, err)
+		}
+		o.addFileEnv(env)
+	}
+	return nil
+}
+
+// addFileEnv adds env to the variables loaded from files, replacing any
+// previously loaded values.
+func (o *option) addFileEnv(env map[string]string) {
+	if o.fileEnv == nil {
+		o.fileEnv = make(map[string]string)
+	}
+	for k, v := range env {
+		o.fileEnv[k] = v
+	}
+}
+
+// ParseDotenv parses variables from r in the format of a file given to
+// EnvFile, as Parse would, and returns them keyed by name, so that the same
+// format can be read elsewhere, such as by a tool which checks the file. A
+// key defined more than once is given its last value.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	return parseDotenv(r, LastWins)
+}
+
+func parseDotenv(r io.Reader, policy DupePolicy) (map[string]string, error) {
+	env := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: missing '='", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", n)
+		}
+		// A quoted value continues onto following lines until its closing
+		// quote, keeping their whitespace and line breaks.
+		var raw strings.Builder
+		raw.WriteString(strings.TrimLeft(s.Text()[strings.Index(s.Text(), "=")+1:], " \t"))
+		start := n
+		if v := raw.String(); v != "" && (v[0] == '\'' || v[0] == '"') {
+			for end, next := quoteEnd(v, 1); end < 0 && s.Scan(); end, next = quoteEnd(raw.String(), next) {
+				raw.WriteString("\n")
+				raw.WriteString(s.Text())
+				n++
+			}
+		}
+		value, err := parseDotenvValue(strings.TrimSpace(raw.String()))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", start, err)
+		}
+		if _, dup := env[key]; dup {
+			switch policy {
+			case FirstWins:
+				continue
+			case DupeError:
+				return nil, fmt.Errorf("line %d: duplicate key %s", start, key)
+			}
+		}
+		env[key] = value
+	}
+	return env, s.Err()
+}
+
+// quoteEnd returns the index of the quote which closes the quoted value s,
+// or -1 if it's unterminated, scanning from index from, and the index from
+// which to resume scanning once more of the value is appended to s.
+func quoteEnd(s string, from int) (end, next int) {
+	q := s[0]
+	for end = from; end < len(s); end++ {
+		switch {
+		case s[end] == q:
+			return end, end + 1
+		case q == '"' && s[end] == '\\':
+			end++
+		}
+	}
+	return -1, end
+}
+
+var dotenvEscaper = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+func parseDotenvValue(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	switch q := s[0]; q {
+	case '\'', '"':
+		end, _ := quoteEnd(s, 1)
+		if end < 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && rest[0] != '#' {
+			return "", errors.New("unexpected characters after quoted value")
+		}
+		if q == '\'' {
+			return s[1:end], nil
+		}
+		return dotenvEscaper.Replace(s[1:end]), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// WriteTemplate writes a template for a file loaded by EnvFile to w, with an
+// assignment of the default value of each flag in the FlagSet to the
+// environment variable key from which Parse would first read it with the
+// given options, preceded by the flag's usage as a comment. Default values of
+// bool flags are written as "true" or "false", and those of flags marked as
+// sensitive by Redact or with Secret values are left empty. Flags which would
+// not be read from the environment are skipped. Like EnvKey, WriteTemplate
+// does not access the environment, so options which depend on it have no
+// effect.
+func WriteTemplate(w io.Writer, options ...Option) error {
+	o := &option{set: flag.CommandLine}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return o.err
+	}
+	var buf bytes.Buffer
+	o.set.VisitAll(func(f *flag.Flag) {
+		keys := o.primaryKeys(f.Name)
+		if len(keys) == 0 {
+			return
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		if f.Usage != "" {
+			for _, line := range strings.Split(f.Usage, "\n") {
+				buf.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+			}
+		}
+		def := o.defValue(f)
+		if o.sensitive(f) {
+			def = ""
+		} else if o.normalizeBool(f) {
+			if v, ok := o.boolValue(def); ok {
+				def = v
+			}
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", keys[0], dotenvQuote(def))
+	})
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("envflag: writing template: %v", err)
+	}
+	return nil
+}
+
+var dotenvQuoter = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`, `"`, `\"`, `\`, `\\`)
+
+// dotenvQuote returns s quoted so that parseDotenvValue returns it, if necessary.
+func dotenvQuote(s string) string {
+	if s != strings.TrimSpace(s) || strings.ContainsAny(s, "#'\"\\\n\r\t") {
+		return `"` + dotenvQuoter.Replace(s) + `"`
+	}
+	return s
+}
@@ -0,0 +1,205 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	const input = `
+# comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = spaced value  # trailing comment
+EQUALS=a=b=c
+EMPTY=
+SINGLE='literal \n # not a comment'
+DOUBLE="line\nbreak \"quoted\" # kept" # comment
+HASH=abc#def
+`
+	got, err := parseDotenv(strings.NewReader(input), LastWins)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "yes",
+		"SPACED":   "spaced value",
+		"EQUALS":   "a=b=c",
+		"EMPTY":    "",
+		"SINGLE":   `literal \n # not a comment`,
+		"DOUBLE":   "line\nbreak \"quoted\" # kept",
+		"HASH":     "abc#def",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+	for _, bad := range []string{"NOEQUALS", "=value", `KEY="unterminated`, `KEY='a''b'`} {
+		if _, err := parseDotenv(strings.NewReader(bad), LastWins); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestParseDotenvMultiline(t *testing.T) {
+	input := strings.Join([]string{
+		`export CERT="-----BEGIN-----`,
+		`  indented`,
+		`-----END-----"`,
+		`LITERAL='#notacomment`,
+		`second # line'  # comment`,
+		`QUOTED="#notacomment"`,
+		`ESCAPED="a \" quote`,
+		`and more"`,
+		`PLAIN=value`,
+		``,
+	}, "\r\n")
+	got, err := ParseDotenv(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"CERT":    "-----BEGIN-----\n  indented\n-----END-----",
+		"LITERAL": "#notacomment\nsecond # line",
+		"QUOTED":  "#notacomment",
+		"ESCAPED": "a \" quote\nand more",
+		"PLAIN":   "value",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+	_, err = ParseDotenv(strings.NewReader("A=1\nKEY=\"open\nnever closed\n"))
+	if err == nil || err.Error() != "line 2: unterminated quoted value" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDuplicateKeyPolicy(t *testing.T) {
+	const input = "KEY=first\nKEY=second\n"
+	for _, tt := range []struct {
+		policy  DupePolicy
+		want    string
+		wantErr bool
+	}{
+		{policy: LastWins, want: "second"},
+		{policy: FirstWins, want: "first"},
+		{policy: DupeError, wantErr: true},
+	} {
+		env, err := parseDotenv(strings.NewReader(input), tt.policy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("policy %d: expected error", tt.policy)
+			}
+			continue
+		}
+		if err != nil || env["KEY"] != tt.want {
+			t.Errorf("policy %d: want: %q; got: %q (err: %v)", tt.policy, tt.want, env["KEY"], err)
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_ENV=process"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	if err := os.WriteFile(path, []byte("APP_ENV=file\nAPP_FILE=file\nAPP_ARG=file\nAPP_DUPE=1\nAPP_DUPE=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("env_file", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	env := set.String("env", "", "")
+	file := set.String("file", "", "")
+	arg := set.String("arg", "", "")
+	def := set.String("def", "default", "")
+	dupe := set.Int("dupe", 0, "")
+	err := Parse(FlagSet(set), Args([]string{"--arg=arg"}), Prefix("APP_"),
+		EnvFile(filepath.Join(dir, "missing.env")), EnvFile(path))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *env != "process" || *file != "file" || *arg != "arg" || *def != "default" || *dupe != 2 {
+		t.Errorf("unexpected values: env=%q file=%q arg=%q def=%q dupe=%d", *env, *file, *arg, *def, *dupe)
+	}
+
+	set = flag.NewFlagSet("env_file", flag.ContinueOnError)
+	set.Int("dupe", 0, "")
+	if err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), EnvFile(path), DuplicateKeyPolicy(DupeError)); err == nil {
+		t.Error("duplicate: expected error")
+	}
+	if err := Parse(FlagSet(set), Args(nil), MustEnvFile(filepath.Join(dir, "missing.env"))); err == nil {
+		t.Error("missing: expected error")
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	set := flag.NewFlagSet("write_template", flag.ContinueOnError)
+	set.String("log.level", "info", "log level:\ndebug, info, or error")
+	set.Bool("verbose", false, "")
+	set.String("greeting", `say "hi" # twice`, "greeting to print")
+	set.Var(&Secret{}, "token", "API token")
+	var buf bytes.Buffer
+	if err := WriteTemplate(&buf, FlagSet(set), Prefix("APP_")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `# greeting to print
+APP_GREETING="say \"hi\" # twice"
+
+# log level:
+# debug, info, or error
+APP_LOG_LEVEL=info
+
+# API token
+APP_TOKEN=
+
+APP_VERBOSE=false
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	env, err := parseDotenv(&buf, DupeError)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := env["APP_GREETING"], `say "hi" # twice`; got != want {
+		t.Errorf("greeting: want: %q; got: %q", want, got)
+	}
+}
+
+func TestEnvReader(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"ENV=process"})
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("FILE=file\nBOTH=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("env_reader", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	env := set.String("env", "", "")
+	file := set.String("file", "", "")
+	both := set.String("both", "", "")
+	quoted := set.String("quoted", "", "")
+	res, err := ParseWithResult(FlagSet(set), Args(nil),
+		EnvFile(path),
+		EnvReader(strings.NewReader("ENV=reader\nBOTH=reader\nexport QUOTED='a # b' # comment\n")),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *env != "process" || *file != "file" || *both != "reader" || *quoted != "a # b" {
+		t.Errorf("unexpected values: env=%q file=%q both=%q quoted=%q", *env, *file, *both, *quoted)
+	}
+	if src := res.Sources["quoted"]; src != SourceFile {
+		t.Errorf("source: want: %v; got: %v", SourceFile, src)
+	}
+
+	set = flag.NewFlagSet("env_reader", flag.ContinueOnError)
+	if err := Parse(FlagSet(set), Args(nil), EnvReader(strings.NewReader("NOEQUALS\n"))); err == nil {
+		t.Error("expected error")
+	}
+}
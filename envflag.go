@@ -6,18 +6,167 @@
 package envflag
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // An Option is an option.
 type Option func(o *option)
 
 type option struct {
-	set    *flag.FlagSet
-	args   []string
-	prefix string
+	set            *flag.FlagSet
+	args           []string
+	prefix         string
+	prefixes       []string
+	prefixSet      bool
+	groups         map[string]string
+	stripPrefix    bool
+	prefixFallback bool
+	acronyms       bool
+	preserveCase   bool
+	exactCase      bool
+	fuzzy          bool
+	interpolate    bool
+	separator      *string
+	mapper         func(string) string
+	static         map[string]string
+	staticFallback bool
+	names          map[string]string
+	namesFallback  bool
+	aliases        map[string][]string
+	deprecated     map[string]string
+	warnAliases    bool
+	lookup         func(string) (string, bool)
+	environ        func() map[string]string
+	ctx            context.Context
+	resolver       *Resolver
+	killKey        string
+
+	prefixWhen []conditionalPrefix
+
+	source           LookupFunc
+	attempts         int
+	backoff          time.Duration
+	sticky           string
+	stickyTTL        time.Duration
+	stickyCache      *stickyCache
+	fetched          map[string]string
+	stale            bool
+	envFiles         []envFile
+	dupePolicy       DupePolicy
+	fileEnv          map[string]string
+	defaults         map[string]string
+	consulted        map[string]bool
+	overridden       []string
+	strict           bool
+	platformDefaults map[string]map[string]string
+
+	provider Provider
+	chains   map[string][]string
+	shadows  []*flag.FlagSet
+
+	formats            map[string][]valueFormat
+	placeholders       []*regexp.Regexp
+	rejectPlaceholders bool
+	atomic             bool
+	trueWords          map[string]bool
+	falseWords         map[string]bool
+	boolValues         bool
+	truthy             []string
+	falsy              []string
+	configured         []string
+	requireSource      map[string]Source
+	envOnly            map[string]bool
+	argsOnly           map[string]bool
+	filters            []func(*flag.Flag) bool
+	precedence         PrecedenceOrder
+	detectConflicts    bool
+	presence           map[string]bool
+	presenceAll        bool
+	unsetEmpty         map[string]bool
+	unsetEmptyAll      bool
+	exclusive          [][]string
+	exactly            []exactly
+	priorities         map[string][]Source
+	lines              map[string]bool
+	split              map[string]string
+	indexed            map[string]bool
+	indexValues        map[string][]string
+	counts             map[string]bool
+	rawBool            map[string]bool
+	defaultKeyword     string
+	ignorePreset       bool
+	envMaps            map[string]string
+	jsonFiles          []string
+	jsonValues         map[string][]string
+	configFiles        []configFile
+	configValues       map[string][]string
+	trimAll            bool
+	trim               map[string]bool
+	commentMarker      string
+	expand             bool
+	expandStrict       bool
+	intBase            map[string]bool
+	noLeadingZeros     map[string]bool
+	fileAllowed        map[string]bool
+	fileAll            bool
+	codecs             map[string]codec
+	schemes            map[string]func(context.Context, *url.URL) (string, error)
+	transforms         map[string]func(string) (string, error)
+	afterSet           []afterSet
+	types              map[string]string
+	bounds             []bounds
+	enums              []enum
+	readOnce           []string
+	nonEmpty           []string
+	required           []string
+	schemas            []interface{}
+	flagValidators     []func(*flag.Flag) error
+	validators         []func(*flag.FlagSet) error
+
+	redact           map[string]bool
+	provenance       string
+	provenanceFormat Format
+	metrics          io.Writer
+	onComplete       []func(Stats)
+	logger           *slog.Logger
+	annotateUsage    bool
+
+	sources     map[string]Source
+	dryRun      bool
+	watch       *watcher
+	signals     []*signalWatcher
+	warnings    int
+	warnLimit   int
+	warnOut     io.Writer
+	log         Logger
+	warnLimited bool
+	collector   *[]error
+	allErrors   bool
+	envKeys     map[string]string
+	raw         *map[string]string
+	onEnvSet    []func(flagName, envKey, value string)
+	reported    bool
+
+	err error
+}
+
+type valueFormat struct {
+	detect  func(string) bool
+	message string
 }
 
 // FlagSet returns an Option which specifies the set of flags to parse.
@@ -28,6 +177,39 @@ func FlagSet(set *flag.FlagSet) Option {
 	}
 }
 
+// FlagSets returns an Option which specifies several flag sets to parse as
+// one, such as those of an application's subsystems, in place of FlagSet. The
+// argument list and the environment are resolved against the flags of all
+// the sets with the same options, and the usage message lists them together.
+// The sets are combined into a new FlagSet with the name, error handling, and
+// output of the first, which defines each flag with its original value, so
+// the flags' variables are set as usual. A flag name may be defined in only
+// one of the sets, since a single argument or environment variable cannot be
+// routed between definitions; otherwise Parse fails with an error like that
+// of DetectShadows. Parsing stops at the first non-flag argument, as for a
+// single set, and the remaining arguments are given by the Result of
+// ParseWithResult, since the sets themselves are not marked as parsed.
+func FlagSets(sets ...*flag.FlagSet) Option {
+	return func(o *option) {
+		if len(sets) == 0 {
+			o.err = errors.New("envflag: no flag sets")
+			return
+		}
+		if err := detectShadows(sets); err != nil {
+			o.err = err
+			return
+		}
+		o.set = flag.NewFlagSet(sets[0].Name(), sets[0].ErrorHandling())
+		o.set.SetOutput(sets[0].Output())
+		for _, set := range sets {
+			set.VisitAll(func(f *flag.Flag) {
+				o.set.Var(f.Value, f.Name, f.Usage)
+				o.set.Lookup(f.Name).DefValue = f.DefValue
+			})
+		}
+	}
+}
+
 // Args returns an Option which specifies the argument list to parse, which
 // should not include the command name. If unused, os.Args[1:] is the default.
 func Args(arguments []string) Option {
@@ -37,57 +219,1264 @@ func Args(arguments []string) Option {
 }
 
 // Prefix returns an Option which specifies a prefix for flag names when
-// looking up corresponding enviroment variables.
+// looking up corresponding enviroment variables. It replaces any prefixes
+// given by Prefixes. The prefix is joined to flag names by the Separator, "_"
+// by default, unless it already ends with one, or with "_", ".", or "-", so
+// that with either Prefix("APP") or Prefix("APP_"), the flag "log.level" is
+// looked up as APP_LOG_LEVEL. A prefix is used verbatim with a NameMapper.
 func Prefix(prefix string) Option {
 	return func(o *option) {
 		o.prefix = prefix
+		o.prefixes = nil
+		o.prefixSet = true
+	}
+}
+
+// AutoPrefix returns an Option which derives the prefix for flag names from
+// the name of the program, as given by os.Args[0], so that "myapp" reads
+// variables such as MYAPP_PORT. The name is stripped of its directory and of
+// any ".exe" extension, uppercased, and each character other than a letter or
+// digit is replaced by "_", and then "_" is appended. A symbolic link to the
+// program gives the name of the link, as for a multi-call binary. A prefix
+// given by Prefix or Prefixes takes precedence, regardless of order.
+func AutoPrefix() Option {
+	return func(o *option) {
+		if !o.prefixSet {
+			o.prefix = programPrefix(os.Args[0])
+		}
+	}
+}
+
+// programPrefix returns the prefix derived from a program's path.
+func programPrefix(path string) string {
+	name := filepath.Base(path)
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".exe") {
+		name = name[:len(name)-len(ext)]
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	if !strings.HasSuffix(name, "_") {
+		name += "_"
+	}
+	return name
+}
+
+// Prefixes returns an Option which specifies several prefixes for flag names
+// when looking up corresponding environment variables. They're tried in order
+// for each flag, and the value of the first key that is set is used, so with
+// Prefixes("BRANDA_", "COMMON_"), the flag "log-level" is looked up as
+// BRANDA_LOG_LEVEL and then as COMMON_LOG_LEVEL. An empty prefix looks up the
+// unprefixed key. EnvKey and AnnotateUsage report the key with the first
+// prefix. It replaces any prefix given by Prefix.
+func Prefixes(prefixes ...string) Option {
+	return func(o *option) {
+		o.prefix = ""
+		o.prefixes = append([]string{}, prefixes...)
+		o.prefixSet = true
+	}
+}
+
+// PrefixWhen returns an Option which specifies a prefix to use instead of the
+// one given by Prefix if detect returns true. Detectors are called in the order
+// of their options when parsing begins, and the prefix of the first to return
+// true is used. If none return true, the prefix given by Prefix is used.
+func PrefixWhen(detect func() bool, prefix string) Option {
+	return func(o *option) {
+		o.prefixWhen = append(o.prefixWhen, conditionalPrefix{detect, prefix})
+	}
+}
+
+type conditionalPrefix struct {
+	detect func() bool
+	prefix string
+}
+
+// WarnValueFormat returns an Option which warns when the environment variable
+// value for the named flag is in a deprecated format, as reported by detect.
+// The warning, including message, is written to the FlagSet's output and the
+// value is still used. Values passed as command line flags are not checked.
+func WarnValueFormat(name string, detect func(string) bool, message string) Option {
+	return func(o *option) {
+		if o.formats == nil {
+			o.formats = make(map[string][]valueFormat)
+		}
+		o.formats[name] = append(o.formats[name], valueFormat{detect, message})
+	}
+}
+
+// KeyChain returns an Option which specifies the environment variable keys
+// to look up, in order, for the named flag instead of the key derived from
+// its name. A key beginning with "/" is absolute: the rest of it is used
+// verbatim. Any other key is relative: it is given the Prefix and transformed
+// like a flag name. For example, with Prefix("APP_"),
+//
+//	KeyChain("db.host", "database.host", "/DB_HOST")
+//
+// looks up APP_DATABASE_HOST and then DB_HOST.
+func KeyChain(flagName string, keys ...string) Option {
+	return func(o *option) {
+		if o.chains == nil {
+			o.chains = make(map[string][]string)
+		}
+		o.chains[flagName] = keys
+	}
+}
+
+// DetectShadows returns an Option which causes Parse to fail if any flag is
+// defined in more than one of the parsed FlagSet and the given sets, since
+// the same environment variable would resolve each definition. The error lists
+// each shadowed flag with the names of the sets that define it. The check is
+// done before anything is parsed.
+func DetectShadows(sets ...*flag.FlagSet) Option {
+	return func(o *option) {
+		o.shadows = append(o.shadows, sets...)
+	}
+}
+
+func detectShadows(sets []*flag.FlagSet) error {
+	defs := make(map[string][]string)
+	var names []string
+	for _, set := range sets {
+		set.VisitAll(func(f *flag.Flag) {
+			if len(defs[f.Name]) == 1 {
+				names = append(names, f.Name)
+			}
+			defs[f.Name] = append(defs[f.Name], set.Name())
+		})
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("-%s (%s)", name, strings.Join(defs[name], ", "))
+	}
+	return fmt.Errorf("envflag: flags defined in multiple sets: %s", strings.Join(msgs, "; "))
+}
+
+// LinesValues returns an Option which splits the environment variable values
+// of the named flags into lines, passing each non-empty line, trimmed of
+// surrounding whitespace, to the flag's Set method in turn. It is intended for
+// flags that accept multiple values, such as a list of hosts from a Kubernetes
+// ConfigMap. Values passed as command line flags are not split.
+func LinesValues(names ...string) Option {
+	return func(o *option) {
+		if o.lines == nil {
+			o.lines = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.lines[name] = true
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// SplitValues returns an Option which splits the environment variable values
+// of the named flags at each occurrence of sep, passing each element to the
+// flag's Set method in turn, so that TAGS=a,b,c calls Set("a"), Set("b"), and
+// Set("c"). It is intended for flags that accept multiple values, such as a
+// custom flag.Value holding a list. A backslash escapes a literal sep or
+// backslash, so with a sep of "," the value `a\,b,c` has the elements "a,b"
+// and "c". If sep is empty, it is ",". Values passed as command line flags
+// are not split.
+func SplitValues(sep string, names ...string) Option {
+	return func(o *option) {
+		if sep == "" {
+			sep = ","
+		}
+		if o.split == nil {
+			o.split = make(map[string]string)
+		}
+		for _, name := range names {
+			o.split[name] = sep
+		}
+	}
+}
+
+// splitEscaped splits s at each occurrence of sep not escaped by a backslash.
+func splitEscaped(s, sep string) []string {
+	var elems []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && strings.HasPrefix(s[i+1:], sep):
+			b.WriteString(sep)
+			i += len(sep)
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '\\':
+			b.WriteByte('\\')
+			i++
+		case strings.HasPrefix(s[i:], sep):
+			elems = append(elems, b.String())
+			b.Reset()
+			i += len(sep) - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(elems, b.String())
+}
+
+// DefaultKeyword returns an Option which specifies a keyword, such as
+// "default", which, as the value of a flag from the environment or another
+// source other than the argument list, sets the flag to its default value by
+// passing the default's string form to its Set method, so that an upper layer
+// of configuration can revert the value given by a lower layer, such as one
+// preferred by FlagPriority. The keyword is matched case-insensitively. As
+// with Reset, a flag whose Set method accumulates values, such as a list,
+// gains its default value as another element instead.
+func DefaultKeyword(keyword string) Option {
+	return func(o *option) {
+		o.defaultKeyword = keyword
+	}
+}
+
+// CountFlags returns an Option which treats the named flags as counters, such
+// as a verbosity flag for which -v -v -v means 3, so that a value from the
+// environment or another source other than the argument list is a count of
+// the times to pass "true" to the flag's Set method, as the flag package does
+// for each occurrence of a bool flag, so that VERBOSE=3 is equivalent to
+// -v -v -v. A count of 0 leaves the flag at its default value. A value which
+// isn't a decimal integer from 0 to 65535 is an invalid value for the flag.
+func CountFlags(names ...string) Option {
+	return func(o *option) {
+		if o.counts == nil {
+			o.counts = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.counts[name] = true
+		}
+	}
+}
+
+// errCount is the error for an invalid value of a flag named by CountFlags.
+var errCount = errors.New("count must be an integer from 0 to 65535")
+
+// IndexedLists returns an Option which reads the environment variable values
+// of the named flags from indexed keys, such as ENDPOINT_0, ENDPOINT_1, and so
+// on for the flag "endpoint", passing each value to the flag's Set method in
+// numeric order. It is intended for flags that accept multiple values whose
+// elements cannot safely contain a separator for SplitValues. Indices begin at
+// 0 and the first missing index ends the list, so that ENDPOINT_3 is ignored
+// if ENDPOINT_2 is not set; Strict reports such keys as unrecognized. The
+// index is appended to each of the flag's keys with the Separator. If no
+// indexed key is set, the flag's key itself is looked up as usual.
+func IndexedLists(names ...string) Option {
+	return func(o *option) {
+		if o.indexed == nil {
+			o.indexed = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.indexed[name] = true
+		}
+	}
+}
+
+// indexedKey returns the ith indexed key for key.
+func (o *option) indexedKey(key string, i int) string {
+	sep := "_"
+	if o.separator != nil {
+		sep = *o.separator
+	}
+	return key + sep + strconv.Itoa(i)
+}
+
+// lookupIndexed looks up the indexed keys for key and returns their values,
+// processed for the named flag, and their raw values joined by newlines.
+func (o *option) lookupIndexed(name, key string) (values []string, raw string, err error) {
+	var raws []string
+	for i := 0; ; i++ {
+		k := o.indexedKey(key, i)
+		v, ok := o.lookupKey(k)
+		if !o.defined(name, v, ok) {
+			return values, strings.Join(raws, "\n"), nil
+		}
+		raws = append(raws, v)
+		o.envSet(name, k, v)
+		if v, err = o.envValue(name, k, v); err != nil {
+			return nil, "", err
+		}
+		values = append(values, v)
+	}
+}
+
+// Atomic returns an Option which restores every flag to its prior value if
+// parsing fails, so that flags are either all resolved or all left untouched.
+// Before parsing, the string form of each flag's value is saved and, on error,
+// passed back to the Set method of each flag whose value changed. This costs
+// a String call per flag on every parse. Values whose Set method is not
+// idempotent (e.g. appending to a list) may not be fully restored, and errors
+// from Set methods which reject their prior values are added to the error
+// returned by Parse. The FlagSet's record of which flags have been set, as
+// reported by its Visit and Parsed methods, cannot be undone.
+func Atomic() Option {
+	return func(o *option) {
+		o.atomic = true
+	}
+}
+
+// restore passes the saved string form of each flag's value to its Set method,
+// if its value changed, and returns the errors for those it rejects.
+func (o *option) restore(saved map[*flag.Flag]string) []error {
+	var errs []error
+	o.set.VisitAll(func(f *flag.Flag) {
+		v, ok := saved[f]
+		if !ok || rawString(f.Value) == v {
+			return
+		}
+		if err := f.Value.Set(v); err != nil {
+			errs = append(errs, fmt.Errorf("envflag: restoring flag -%s: %s", f.Name, o.redactString(f.Name, err.Error(), v)))
+		}
+	})
+	return errs
+}
+
+// BoolValues returns an Option which replaces the built-in synonyms recognized
+// for bool flags in the environment, "true", "yes", "y", and "1" for true and
+// "false", "no", "n", and "0" for false, with truthy and falsy, such as "on"
+// and "off" or "enabled" and "disabled". Values are matched case-insensitively.
+// Words added by BoolLocale are still recognized. A value which matches no
+// synonym is passed to the flag's Set method unchanged and, if it is rejected,
+// the error lists the recognized synonyms. A word that appears in both truthy
+// and falsy causes Parse to fail.
+func BoolValues(truthy, falsy []string) Option {
+	return func(o *option) {
+		o.boolValues = true
+		o.truthy, o.falsy = nil, nil
+		for _, w := range truthy {
+			o.truthy = append(o.truthy, strings.ToLower(w))
+		}
+		for _, w := range falsy {
+			w = strings.ToLower(w)
+			o.falsy = append(o.falsy, w)
+			for _, t := range o.truthy {
+				if t == w && o.err == nil {
+					o.err = fmt.Errorf("envflag: bool word %q is both true and false", w)
+				}
+			}
+		}
+	}
+}
+
+// RawBool returns an Option which passes the values of the named bool flags
+// from the environment and other sources to their Set methods unchanged,
+// rather than normalizing synonyms such as "yes" to "true", as for flags with
+// values of their own, such as a tristate which also accepts "auto". A value
+// may instead opt out of normalization itself by implementing
+//
+//	interface{ NoEnvNormalize() bool }
+//
+// and returning true.
+func RawBool(names ...string) Option {
+	return func(o *option) {
+		if o.rawBool == nil {
+			o.rawBool = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.rawBool[name] = true
+		}
+	}
+}
+
+// normalizeBool reports whether the values of f are normalized as bools.
+func (o *option) normalizeBool(f *flag.Flag) bool {
+	if !isBoolFlag(f.Value) || o.rawBool[f.Name] {
+		return false
+	}
+	v, ok := f.Value.(interface{ NoEnvNormalize() bool })
+	return !ok || !v.NoEnvNormalize()
+}
+
+// BoolLocale returns an Option which adds locale-specific words, such as "oui"
+// and "non", to the synonyms recognized for bool flags in the environment.
+// Words are matched case-insensitively, in addition to the built-in synonyms.
+// A word that appears in both trueWords and falseWords causes Parse to fail.
+func BoolLocale(trueWords, falseWords map[string]bool) Option {
+	return func(o *option) {
+		if o.trueWords == nil {
+			o.trueWords = make(map[string]bool)
+			o.falseWords = make(map[string]bool)
+		}
+		for w, ok := range trueWords {
+			if ok {
+				o.trueWords[strings.ToLower(w)] = true
+			}
+		}
+		for w, ok := range falseWords {
+			if ok {
+				o.falseWords[strings.ToLower(w)] = true
+			}
+		}
+		for w := range o.trueWords {
+			if o.falseWords[w] && o.err == nil {
+				o.err = fmt.Errorf("envflag: bool word %q is both true and false", w)
+			}
+		}
+	}
+}
+
+// BoolByPresence returns an Option which sets the named bool flags, or all
+// bool flags if none are named, to true whenever one of their environment
+// variables is defined, including in a file given to EnvFile, regardless of
+// its value, as is conventional for feature toggles. Any value, including the
+// empty string and "false", sets the flag to true; an undefined variable leaves
+// the flag at its default value. Values from other sources are unaffected.
+func BoolByPresence(names ...string) Option {
+	return func(o *option) {
+		if len(names) == 0 {
+			o.presenceAll = true
+			return
+		}
+		if o.presence == nil {
+			o.presence = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.presence[name] = true
+		}
+	}
+}
+
+// EmptyMeansUnset returns an Option which treats an environment variable of
+// the named flags, or of all flags if none are named, which is defined with
+// the empty string as its value as though it were undefined, as many shells
+// and orchestrators do. For a flag with the key PORT:
+//
+//	PORT        default          EmptyMeansUnset
+//	undefined   left at default  left at default
+//	PORT=       Set("")          left at default
+//	PORT=80     Set("80")        Set("80")
+//
+// By default, a flag is set to the empty string, which is an error for flags
+// such as ints and durations but may be intended for string flags, which can
+// be kept so by naming the other flags. An empty variable is then skipped in
+// favor of the flag's next key or source, including a file given to EnvFile,
+// and doesn't count as defined for BoolByPresence.
+func EmptyMeansUnset(names ...string) Option {
+	return func(o *option) {
+		if len(names) == 0 {
+			o.unsetEmptyAll = true
+			return
+		}
+		if o.unsetEmpty == nil {
+			o.unsetEmpty = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.unsetEmpty[name] = true
+		}
+	}
+}
+
+// defined reports whether a value for the named flag, as returned by a lookup
+// with ok, counts as defined.
+func (o *option) defined(name, value string, ok bool) bool {
+	return ok && (value != "" || !(o.unsetEmptyAll || o.unsetEmpty[name]))
+}
+
+// IgnorePreset returns an Option which resolves flags which were set before
+// Parse, such as by a library calling Set to seed a FlagSet with values of its
+// own, from the environment and other sources as though they hadn't been set,
+// unless they're also given in the argument list. By default, the FlagSet
+// records them as set, as it does flags given in the argument list, and so
+// Parse leaves them unchanged, as it does those given in the argument list.
+// Their values are replaced only by those of other sources, rather than being
+// reset to their default values.
+func IgnorePreset() Option {
+	return func(o *option) {
+		o.ignorePreset = true
+	}
+}
+
+// RequireUnlessDefault returns an Option which causes Parse to fail if any
+// of the named flags is left at its default value without the argument list
+// or the environment having provided it. Unlike requiring that a flag differ
+// from its default, a source may still explicitly set a flag to its default
+// value; it is only the silent fallback to the default that is rejected.
+func RequireUnlessDefault(names ...string) Option {
+	return func(o *option) {
+		o.configured = append(o.configured, names...)
 	}
 }
 
 // Parse parses flag definitions from the argument list and the environment,
-// giving preference to the argument list over the environment.
+// giving preference to the argument list over the environment. Flags not set
+// by the argument list are resolved and set in lexicographical order of their
+// names, so errors and the calls to Set methods are reproducible. An invalid
+// value from a source other than the argument list is handled according to
+// the FlagSet's error handling mode, as the flag package handles one in the
+// argument list, except that the error identifies the key from which the
+// value was read and no usage message is written. Flags are set from other
+// sources by calling their Set methods directly with the values as read,
+// without quoting. The argument list is parsed only once, so the arguments
+// remaining after the flags, including any which follow "--", are left by the
+// FlagSet as flag.Parse leaves them.
 func Parse(options ...Option) error {
+	return ParseContext(context.Background(), options...)
+}
+
+// ParseContext is like Parse, but uses the given context for any lookups
+// which may block, such as those of a LookupSource, and for reading files,
+// such as those given by EnvFile and FileAllowed. If the context is done
+// before a file is read, ParseContext fails with the context's error.
+func ParseContext(ctx context.Context, options ...Option) error {
+	_, err := parseContext(ctx, nil, options)
+	return err
+}
+
+// ParseSubcommand is like Parse, but parses the flags of set, the FlagSet of
+// the named subcommand, from variables with a prefix scoped to the
+// subcommand and then from those with the global prefix, given by Prefix or
+// Prefixes. The scoped prefix is the global prefix followed by the
+// subcommand's name, so that with Prefix("APP_"), the flag "port" of the
+// subcommand "serve" is looked up as APP_SERVE_PORT and then as APP_PORT.
+// With several global prefixes, each of their scoped prefixes is tried before
+// any of them. If Args is unused, the argument list is os.Args[2:], as for a
+// program invoked as "app serve -port=80", and the arguments which follow the
+// flags are left in set.Args. PrefixWhen replaces the layered prefixes.
+func ParseSubcommand(name string, set *flag.FlagSet, options ...Option) error {
+	o := &option{}
+	for _, opt := range options {
+		opt(o)
+	}
+	globals := o.prefixes
+	if len(globals) == 0 {
+		globals = []string{o.prefix}
+	}
+	var prefixes []string
+	for _, prefix := range globals {
+		prefixes = append(prefixes, o.joinPrefix(prefix)+name)
+	}
+	prefixes = append(prefixes, globals...)
+	var args []string
+	if len(os.Args) > 2 {
+		args = os.Args[2:]
+	}
+	options = append([]Option{Args(args)}, options...)
+	return Parse(append(options, FlagSet(set), Prefixes(prefixes...))...)
+}
+
+// exit is os.Exit, replaced in tests.
+var exit = os.Exit
+
+// MustParse is like Parse, but handles an error as flag.Parse does for a
+// FlagSet with the ExitOnError error handling mode, rather than returning it:
+// the error is written to the FlagSet's output, if the flag package has not
+// already written it, and the program exits with status 2, or with status 0
+// if the error is flag.ErrHelp. It does so for FlagSets with the ExitOnError
+// or ContinueOnError modes alike, so that a main function needs no error
+// handling. For a FlagSet with the PanicOnError mode, MustParse panics with
+// the error instead of exiting. Note that the flag package itself exits or
+// panics on errors in the argument list for FlagSets with the ExitOnError or
+// PanicOnError modes, respectively, before Parse returns.
+func MustParse(options ...Option) {
+	var o *option
+	options = append(options[:len(options):len(options)], func(opt *option) { o = opt })
+	err := Parse(options...)
+	if err == nil {
+		return
+	}
+	if err == flag.ErrHelp {
+		exit(0)
+		return
+	}
+	if !o.reported {
+		fmt.Fprintln(o.set.Output(), err)
+	}
+	if o.set.ErrorHandling() == flag.PanicOnError {
+		panic(err)
+	}
+	exit(2)
+}
+
+// A Result describes where the values of parsed flags came from.
+type Result struct {
+	// Sources maps each flag name to the source of its value.
+	Sources map[string]Source
+	// Keys maps the name of each flag whose value came from the environment,
+	// a file given to EnvFile, or a LookupSource to the key it was read from.
+	Keys map[string]string
+	// Consulted lists the environment variable keys which were looked up,
+	// including those with the suffix "_FILE" read by FileAllowed, in
+	// lexicographical order.
+	Consulted []string
+	// Overridden lists the names of the flags set by the argument list for
+	// which an environment variable was also set, in lexicographical order.
+	Overridden []string
+	// Args holds the arguments remaining after the flags were parsed.
+	Args []string
+	// Values maps each flag name to the string form of its value, which is
+	// "[redacted]" if the flag is sensitive or named by ReadOnce.
+	Values map[string]string
+}
+
+// Count returns the number of flags whose values came from src.
+func (r *Result) Count(src Source) int {
+	n := 0
+	for _, s := range r.Sources {
+		if s == src {
+			n++
+		}
+	}
+	return n
+}
+
+// ParseWithResult is like Parse, but also returns a Result describing where
+// the flags' values came from, such as for logging an audit line at startup
+// or printing diagnostics. If the flags were resolved before an error
+// occurred, such as a validation error, the Result describes them; otherwise
+// it is nil.
+func ParseWithResult(options ...Option) (*Result, error) {
+	options = append(options[:len(options):len(options)], func(o *option) {
+		o.consulted = make(map[string]bool)
+	})
+	return parseContext(context.Background(), nil, options)
+}
+
+func parseContext(ctx context.Context, r *Resolver, options []Option) (*Result, error) {
+	start := time.Now()
 	o := &option{
-		set:  flag.CommandLine,
-		args: os.Args[1:],
+		set:      flag.CommandLine,
+		args:     os.Args[1:],
+		lookup:   os.LookupEnv,
+		environ:  environ,
+		killKey:  DefaultKillSwitch,
+		ctx:      ctx,
+		resolver: r,
 	}
 	for _, opt := range options {
 		opt(o)
 	}
-	if err := o.set.Parse(o.args); err != nil {
+	if o.err != nil {
+		if o.collector != nil {
+			*o.collector = append(*o.collector, o.err)
+		}
+		return nil, o.err
+	}
+	for _, p := range o.prefixWhen {
+		if p.detect() {
+			o.prefix = p.prefix
+			o.prefixes = nil
+			break
+		}
+	}
+	if o.annotateUsage || len(o.redact) > 0 || len(o.platformDefaults) > 0 {
+		o.wrapUsage()
+	}
+	var saved map[*flag.Flag]string
+	if o.atomic {
+		saved = make(map[*flag.Flag]string)
+		o.set.VisitAll(func(f *flag.Flag) { saved[f] = rawString(f.Value) })
+	}
+	err := o.parse()
+	if err != nil && saved != nil {
+		if errs := o.restore(saved); len(errs) > 0 {
+			err = joinErrors(append(unjoin(err), errs...))
+		}
+	}
+	if err != nil && o.collector != nil {
+		*o.collector = append(*o.collector, unjoin(err)...)
+	}
+	o.summarizeWarnings()
+	if err == nil && !o.dryRun {
+		o.guardReads()
+	}
+	if err == nil && o.watch != nil && !o.dryRun {
+		go o.watch.run(o.set, options)
+	}
+	if err == nil && !o.dryRun {
+		for _, w := range o.signals {
+			w.start(o.set, options)
+		}
+	}
+	var res *Result
+	if o.sources != nil {
+		o.set.VisitAll(func(f *flag.Flag) {
+			if _, ok := o.sources[f.Name]; !ok {
+				o.sources[f.Name] = SourceDefault
+			}
+		})
+		if err == nil && !o.dryRun && len(o.onComplete) > 0 {
+			o.complete(start)
+		}
+		res = &Result{Sources: o.sources, Keys: o.envKeys, Overridden: o.overridden, Args: o.set.Args(), Values: make(map[string]string)}
+		o.set.VisitAll(func(f *flag.Flag) {
+			if _, ok := f.Value.(*readOnce); ok {
+				res.Values[f.Name] = redacted
+			} else {
+				res.Values[f.Name] = o.value(f)
+			}
+		})
+		if o.consulted != nil {
+			res.Consulted = sortedKeys(o.consulted)
+		}
+	}
+	return res, err
+}
+
+func (o *option) parse() error {
+	if o.shadows != nil {
+		if err := detectShadows(append([]*flag.FlagSet{o.set}, o.shadows...)); err != nil {
+			return err
+		}
+	}
+	if o.raw != nil {
+		*o.raw = scanArgs(o.set, o.args)
+	}
+	if err := o.checkEnvOnly(); err != nil {
 		return err
 	}
-	unset := make(map[string]*flag.Flag)
-	o.set.VisitAll(func(f *flag.Flag) { unset[f.Name] = f })
-	o.set.Visit(func(f *flag.Flag) { delete(unset, f.Name) })
-	var args []string
-	for name, f := range unset {
-		if v, ok := env(o.prefix + name); ok {
-			if isBoolFlag(f.Value) {
-				switch strings.ToLower(v) {
-				case "true", "yes", "y", "1":
-					v = "true"
-				case "false", "no", "n", "0":
-					v = "false"
+	var preset map[string]bool
+	if o.ignorePreset {
+		preset = make(map[string]bool)
+		o.set.Visit(func(f *flag.Flag) { preset[f.Name] = true })
+		for name := range scanArgs(o.set, o.args) {
+			delete(preset, name)
+		}
+	}
+	if err := o.parseArgs(); err != nil {
+		o.reported = true
+		return err
+	}
+	disabled := o.disabled()
+	if !disabled {
+		if err := o.loadEnvFiles(); err != nil {
+			return err
+		}
+		if err := o.loadJSONFiles(); err != nil {
+			return err
+		}
+		if err := o.loadConfigFiles(); err != nil {
+			return err
+		}
+	}
+	o.sources = make(map[string]Source)
+	o.envKeys = make(map[string]string)
+	pending := make(map[string]*flag.Flag)
+	if !disabled {
+		o.set.VisitAll(func(f *flag.Flag) {
+			if !o.argsOnly[f.Name] && o.filtered(f) {
+				pending[f.Name] = f
+			}
+		})
+	}
+	o.set.Visit(func(f *flag.Flag) {
+		if preset[f.Name] {
+			return
+		}
+		if o.priority(f.Name)[0] == SourceArg {
+			delete(pending, f.Name)
+		}
+		o.sources[f.Name] = SourceArg
+		if o.consulted != nil && !disabled && o.inEnv(f.Name) {
+			o.overridden = append(o.overridden, f.Name)
+		}
+	})
+	var assigns []assignment
+	var errs []error
+	collect := o.collector != nil || o.allErrors
+	resolved := make([]resolution, 0, len(pending))
+	for _, name := range sortedKeys(pending) {
+		v, src, err := o.resolve(pending[name])
+		if err != nil && !collect {
+			return err
+		}
+		r := resolution{flag: pending[name], value: v, src: src, err: err}
+		switch src {
+		case SourceJSON:
+			r.values = append([]string(nil), o.jsonValues[name]...)
+		case SourceConfig:
+			r.values = append([]string(nil), o.configValues[name]...)
+		}
+		resolved = append(resolved, r)
+	}
+	if o.interpolate {
+		if err := o.interpolateValues(resolved); err != nil && !collect {
+			return err
+		}
+	}
+	for _, r := range resolved {
+		f, name, v, src := r.flag, r.flag.Name, r.value, r.src
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		if src == SourceArg {
+			continue
+		}
+		if src == SourceDefault {
+			continue
+		}
+		o.sources[name] = src
+		if key := o.envKeys[name]; key != "" {
+			o.infof("flag -%s: set from %v %s", name, src, key)
+		} else {
+			o.infof("flag -%s: set from %v", name, src)
+		}
+		values := []string{v}
+		if o.defaultKeyword != "" && strings.EqualFold(v, o.defaultKeyword) {
+			values = []string{o.defValue(f)}
+		} else if o.counts[name] {
+			n, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				if !collect {
+					return o.failSet(o.setError(f, v, errCount))
+				}
+				errs = append(errs, o.setError(f, v, errCount))
+				continue
+			}
+			values = make([]string, n)
+			for i := range values {
+				values[i] = "true"
+			}
+		} else if (src == SourceEnv || src == SourceFile) && isBoolFlag(f.Value) && (o.presenceAll || o.presence[name]) {
+			values = []string{"true"}
+		} else if _, ok := o.envMaps[name]; ok && src == SourceEnv {
+			values = o.envMapEntries(name)
+		} else if r.values != nil {
+			values = r.values
+		} else if vs, ok := o.indexValues[name]; ok && src == SourceEnv {
+			values = vs
+		} else if src == SourceEnv && o.lines[name] {
+			values = splitLines(v)
+		} else if sep, ok := o.split[name]; ok && src == SourceEnv {
+			values = splitEscaped(v, sep)
+		}
+		for _, v := range values {
+			if o.normalizeBool(f) {
+				var ok bool
+				if v, ok = o.boolValue(v); !ok {
+					// Set the value now, so that an error can list the
+					// accepted values.
+					if err := o.set.Set(name, v); err != nil {
+						if !collect {
+							return o.failSet(o.boolError(f, v, err))
+						}
+						errs = append(errs, o.boolError(f, v, err))
+					}
+					continue
 				}
 			}
-			args = append(args, "--"+name+"="+v)
+			if collect {
+				if err := o.set.Set(name, v); err != nil {
+					errs = append(errs, o.setError(f, v, err))
+				}
+				continue
+			}
+			assigns = append(assigns, assignment{f, v})
+		}
+	}
+	for _, a := range assigns {
+		if err := o.set.Set(a.flag.Name, a.value); err != nil {
+			return o.failSet(o.setError(a.flag, a.value, err))
+		}
+	}
+	if pErrs := o.setPlatformDefaults(collect); len(pErrs) > 0 {
+		if !collect {
+			return pErrs[0]
 		}
+		errs = append(errs, pErrs...)
 	}
-	if len(args) == 0 {
+	errs = append(errs, o.validate()...)
+	if o.dryRun {
+		return joinErrors(errs)
+	}
+	if len(errs) == 0 {
+		if err := o.runAfterSet(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.logger != nil {
+		o.logFlags()
+	}
+	if len(errs) == 0 && o.provenance != "" {
+		if err := o.writeProvenance(); err != nil {
+			return joinErrors(append(errs, err))
+		}
+	}
+	if o.metrics != nil {
+		if err := o.writeMetrics(); err != nil {
+			return joinErrors(append(errs, err))
+		}
+	}
+	if len(errs) == 0 && o.sticky != "" && !o.stale {
+		return o.writeSticky()
+	}
+	return joinErrors(errs)
+}
+
+// resolve returns the value for a flag and its source, in the order of the
+// flag's priority. The source is SourceArg if the flag was set by the argument
+// list and no source takes precedence over it, or SourceDefault if no source
+// has a value.
+func (o *option) resolve(f *flag.Flag) (string, Source, error) {
+	for _, src := range o.priority(f.Name) {
+		if src == SourceArg {
+			if o.sources[f.Name] == SourceArg {
+				return "", SourceArg, nil
+			}
+			continue
+		}
+		if v, ok, err := o.resolveFrom(f, src); err != nil || ok {
+			return v, src, err
+		}
+	}
+	return "", SourceDefault, nil
+}
+
+// resolveFrom returns the value for a flag from a single source,
+// if the source has one.
+func (o *option) resolveFrom(f *flag.Flag, src Source) (string, bool, error) {
+	switch src {
+	case SourceEnv:
+		if prefix, ok := o.envMaps[f.Name]; ok {
+			entries := o.envMapEntries(f.Name)
+			for _, e := range entries {
+				kv := strings.SplitN(e, "=", 2)
+				o.envSet(f.Name, prefix+kv[0], kv[1])
+			}
+			return "", len(entries) > 0, nil
+		}
+		for _, key := range o.keys(f.Name) {
+			if o.indexed[f.Name] {
+				vs, raw, err := o.lookupIndexed(f.Name, key)
+				if err != nil || len(vs) > 0 {
+					o.useKey(f.Name, key)
+					o.recordRaw(f.Name, raw)
+					if o.indexValues == nil {
+						o.indexValues = make(map[string][]string)
+					}
+					o.indexValues[f.Name] = vs
+					return strings.Join(vs, ","), true, err
+				}
+			}
+			v, ok := o.lookupKey(key)
+			if !o.defined(f.Name, v, ok) {
+				var err error
+				if v, key, ok, err = o.readFileKey(f.Name, key); err != nil {
+					o.useKey(f.Name, key)
+					return "", true, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			o.useKey(f.Name, key)
+			o.recordRaw(f.Name, v)
+			o.envSet(f.Name, key, v)
+			v, err := o.envValue(f.Name, key, v)
+			return v, true, err
+		}
+	case SourceFile:
+		for _, key := range o.keys(f.Name) {
+			v, ok := o.fileEnv[key]
+			if !o.defined(f.Name, v, ok) {
+				continue
+			}
+			o.useKey(f.Name, key)
+			o.recordRaw(f.Name, v)
+			o.envSet(f.Name, key, v)
+			v, err := o.envValue(f.Name, key, v)
+			return v, true, err
+		}
+	case SourceLookup:
+		if o.source == nil {
+			break
+		}
+		for _, key := range o.keys(f.Name) {
+			v, ok, err := o.lookupSource(key)
+			ok = o.defined(f.Name, v, ok)
+			if err == nil && ok {
+				o.recordRaw(f.Name, v)
+				v, err = o.envValue(f.Name, key, v)
+			}
+			if err != nil || ok {
+				o.useKey(f.Name, key)
+				return v, true, err
+			}
+		}
+	case SourceProvider:
+		if o.provider == nil {
+			break
+		}
+		if v, ok, err := o.provide(f); err != nil || ok {
+			o.recordRaw(f.Name, v)
+			return v, true, err
+		}
+	case SourceJSON:
+		if v, ok := o.jsonValue(f.Name); ok {
+			o.recordRaw(f.Name, v)
+			return v, true, nil
+		}
+	case SourceConfig:
+		if v, ok := o.configValue(f.Name); ok {
+			o.recordRaw(f.Name, v)
+			return v, true, nil
+		}
+	case SourceDefaults:
+		if v, ok := o.defaults[f.Name]; ok {
+			o.recordRaw(f.Name, v)
+			return v, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (o *option) validate() []error {
+	errs := o.checkUnknown()
+	errs = append(errs, o.checkConflicts()...)
+	errs = append(errs, o.checkRequired()...)
+	if len(o.configured) > 0 {
+		set := make(map[string]bool)
+		o.set.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		var missing []string
+		for _, name := range o.configured {
+			if f := o.set.Lookup(name); f != nil && !set[name] && f.Value.String() == o.defValue(f) {
+				missing = append(missing, "-"+name)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("envflag: flags not configured: %s", strings.Join(missing, ", ")))
+		}
+	}
+	errs = append(errs, o.checkSources()...)
+	errs = append(errs, o.checkNonEmpty()...)
+	errs = append(errs, o.checkTypes()...)
+	errs = append(errs, o.checkBounds()...)
+	errs = append(errs, o.checkEnums()...)
+	errs = append(errs, o.checkExclusive()...)
+	errs = append(errs, o.checkExactly()...)
+	errs = append(errs, o.checkSchemas()...)
+	errs = append(errs, o.runFlagValidators()...)
+	errs = append(errs, o.runValidators()...)
+	return errs
+}
+
+// An EnvError records a failure to set a flag to a value read from an
+// environment variable, a file given to EnvFile, or a LookupSource, so that
+// callers may identify the variable with errors.As. Its Value is always the
+// value as given to Set, but its message omits the values of sensitive flags.
+type EnvError struct {
+	Flag   string // flag name
+	EnvKey string // key from which the value was read
+	Value  string // value passed to the flag's Set method
+	Err    error  // error returned by the flag's Set method
+
+	text string // redacted message
+}
+
+func (e *EnvError) Error() string {
+	if e.text != "" {
+		return e.text
+	}
+	return fmt.Sprintf("envflag: invalid value %q for flag -%s from %s: %v", e.Value, e.Flag, e.EnvKey, e.Err)
+}
+
+func (e *EnvError) Unwrap() error { return e.Err }
+
+// setError returns the error for failing to set f to v, which is an *EnvError
+// if v was read from a key.
+func (o *option) setError(f *flag.Flag, v string, err error) error {
+	if key := o.envKeys[f.Name]; key != "" {
+		return o.envError(f.Name, key, v, err)
+	}
+	msg, shown := err.Error(), strconv.Quote(v)
+	if o.sensitive(f) {
+		msg, shown = o.redactString(f.Name, msg, v), redacted
+	}
+	return fmt.Errorf("envflag: invalid value %s for flag -%s: %s", shown, f.Name, msg)
+}
+
+// envError returns an *EnvError for failing to process v, read from key for
+// the named flag.
+func (o *option) envError(name, key, v string, err error) error {
+	msg, shown := err.Error(), strconv.Quote(v)
+	if f := o.set.Lookup(name); f != nil && o.sensitive(f) {
+		msg, shown = o.redactString(name, msg, v), redacted
+	}
+	return &EnvError{
+		Flag:   name,
+		EnvKey: key,
+		Value:  v,
+		Err:    err,
+		text:   fmt.Sprintf("envflag: invalid value %s for flag -%s from %s: %s", shown, name, key, msg),
+	}
+}
+
+// lookupKey looks up key in the environment, recording it for the Result.
+func (o *option) lookupKey(key string) (string, bool) {
+	if o.consulted != nil {
+		o.consulted[key] = true
+	}
+	return o.lookup(key)
+}
+
+// inEnv reports whether any of the named flag's keys is set in the environment.
+func (o *option) inEnv(name string) bool {
+	_, _, ok := o.envLookup(name)
+	return ok
+}
+
+// envLookup returns the first of the named flag's keys which is set in the
+// environment and its value, without recording it.
+func (o *option) envLookup(name string) (key, value string, ok bool) {
+	for _, key := range o.keys(name) {
+		if v, ok := o.lookup(key); o.defined(name, v, ok) {
+			return key, v, true
+		}
+	}
+	return "", "", false
+}
+
+func (o *option) recordRaw(name, value string) {
+	if o.raw != nil {
+		(*o.raw)[name] = value
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	defaultTruthy = []string{"true", "yes", "y", "1"}
+	defaultFalsy  = []string{"false", "no", "n", "0"}
+)
+
+// boolValue normalizes a synonym for true or false and reports whether v is
+// one. Otherwise it returns v unchanged.
+func (o *option) boolValue(v string) (string, bool) {
+	truthy, falsy := o.boolWords()
+	s := strings.ToLower(v)
+	for _, w := range truthy {
+		if s == w {
+			return "true", true
+		}
+	}
+	for _, w := range falsy {
+		if s == w {
+			return "false", true
+		}
+	}
+	return v, false
+}
+
+// boolWords returns the synonyms recognized for true and false.
+func (o *option) boolWords() (truthy, falsy []string) {
+	truthy, falsy = defaultTruthy, defaultFalsy
+	if o.boolValues {
+		truthy, falsy = o.truthy, o.falsy
+	}
+	return append(truthy, sortedKeys(o.trueWords)...), append(falsy, sortedKeys(o.falseWords)...)
+}
+
+// A resolution is the result of resolving a flag's value.
+type resolution struct {
+	flag   *flag.Flag
+	value  string
+	values []string // each value from a file given to JSONFile or ConfigFile
+	src    Source
+	err    error
+}
+
+// parseArgs parses the argument list. If it gives values for sensitive flags,
+// they're redacted from any error, which is then handled according to the
+// FlagSet's error handling mode.
+func (o *option) parseArgs() error {
+	var values []string
+	for name, v := range scanArgs(o.set, o.args) {
+		if f := o.set.Lookup(name); v != "" && o.sensitive(f) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return o.set.Parse(o.args)
+	}
+	out, handling := o.set.Output(), o.set.ErrorHandling()
+	var buf bytes.Buffer
+	o.set.SetOutput(&buf)
+	o.set.Init(o.set.Name(), flag.ContinueOnError)
+	err := o.set.Parse(o.args)
+	o.set.SetOutput(out)
+	o.set.Init(o.set.Name(), handling)
+	if err == nil || err == flag.ErrHelp {
+		out.Write(buf.Bytes())
+	} else {
+		// The flag package writes the error followed by the usage message.
+		msg := err.Error()
+		for _, v := range values {
+			msg = strings.Replace(msg, v, redacted, -1)
+		}
+		fmt.Fprintln(out, msg)
+		out.Write(bytes.TrimPrefix(buf.Bytes(), []byte(err.Error()+"\n")))
+		err = errors.New(msg)
+	}
+	if err == nil {
 		return nil
 	}
-	if s := o.set.Args(); len(s) > 0 {
-		args = append(append(args, "--"), s...)
+	switch handling {
+	case flag.ExitOnError:
+		if err == flag.ErrHelp {
+			exit(0)
+		} else {
+			exit(2)
+		}
+	case flag.PanicOnError:
+		panic(err)
+	}
+	return err
+}
+
+// An assignment is a value to be set for a flag once all flags are resolved.
+type assignment struct {
+	flag  *flag.Flag
+	value string
+}
+
+// failSet handles err, an error setting a flag from a source other than the
+// argument list, according to the FlagSet's error handling mode, as the flag
+// package does for errors in the argument list, but annotated with the key
+// from which the value was read.
+func (o *option) failSet(err error) error {
+	switch o.set.ErrorHandling() {
+	case flag.ExitOnError:
+		fmt.Fprintln(o.set.Output(), err)
+		o.reported = true
+		exit(2)
+	case flag.PanicOnError:
+		fmt.Fprintln(o.set.Output(), err)
+		o.reported = true
+		panic(err)
 	}
-	return o.set.Parse(args)
+	return err
 }
 
-func env(name string) (string, bool) {
-	key := strings.ToUpper(name)
-	key = strings.Replace(key, ".", "_", -1)
-	key = strings.Replace(key, "-", "_", -1)
-	return os.LookupEnv(key)
+// boolError returns the error for failing to set the bool flag f to v.
+func (o *option) boolError(f *flag.Flag, v string, err error) error {
+	truthy, falsy := o.boolWords()
+	return fmt.Errorf("%w; accepted values: %s (true), %s (false)", o.setError(f, v, err),
+		strings.Join(truthy, ", "), strings.Join(falsy, ", "))
 }
 
 func isBoolFlag(v flag.Value) bool {
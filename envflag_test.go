@@ -2,23 +2,32 @@ package envflag
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 )
 
 func TestParse(t *testing.T) {
 	tests := []struct {
-		desc      string
-		init      func(*flag.FlagSet)
-		args      []string
-		env       []string
-		prefix    string
-		wantFlags map[string]string
-		wantArgs  []string
-		wantErr   bool
+		desc       string
+		init       func(*flag.FlagSet)
+		args       []string
+		env        []string
+		prefix     string
+		opts       []Option
+		wantFlags  map[string]string
+		wantArgs   []string
+		wantOutput string
+		wantErr    bool
+		wantErrMsg string
 	}{
 		{
 			desc:      "simple",
@@ -48,6 +57,25 @@ func TestParse(t *testing.T) {
 			wantFlags: map[string]string{"envflag_keep_args": "42"},
 			wantArgs:  []string{"keep", "args"},
 		},
+		{
+			desc:      "keep_args_after_terminator",
+			init:      func(f *flag.FlagSet) { f.Int("envflag_keep_terminator", 0, "") },
+			args:      []string{"--", "-envflag_keep_terminator=1", "--", "pos"},
+			env:       []string{"ENVFLAG_KEEP_TERMINATOR=42"},
+			wantFlags: map[string]string{"envflag_keep_terminator": "42"},
+			wantArgs:  []string{"-envflag_keep_terminator=1", "--", "pos"},
+		},
+		{
+			desc: "env_value_verbatim",
+			init: func(f *flag.FlagSet) {
+				f.String("envflag_verbatim", "", "")
+				f.Bool("envflag_verbatim_bool", false, "")
+			},
+			args:      []string{"pos"},
+			env:       []string{`ENVFLAG_VERBATIM=-x=a=b -- "q" 'r'`, "ENVFLAG_VERBATIM_BOOL=yes"},
+			wantFlags: map[string]string{"envflag_verbatim": `-x=a=b -- "q" 'r'`, "envflag_verbatim_bool": "true"},
+			wantArgs:  []string{"pos"},
+		},
 		{
 			desc:      "invalid_arg",
 			init:      func(f *flag.FlagSet) { f.Int("envflag_invalid_arg", -1, "") },
@@ -136,6 +164,705 @@ func TestParse(t *testing.T) {
 				"0":     "false",
 			},
 		},
+		{
+			desc: "warn_value_format",
+			init: func(f *flag.FlagSet) {
+				f.String("hosts", "", "")
+				f.String("ports", "", "")
+			},
+			env: []string{"HOSTS=a,b", "PORTS=[80]"},
+			opts: []Option{
+				WarnValueFormat("hosts", isList, "use a JSON array"),
+				WarnValueFormat("ports", isList, "use a JSON array"),
+			},
+			wantFlags:  map[string]string{"hosts": "a,b", "ports": "[80]"},
+			wantOutput: "envflag: HOSTS: deprecated value format: use a JSON array\n",
+		},
+		{
+			desc: "bool_locale",
+			init: func(f *flag.FlagSet) {
+				f.Bool("oui", false, "")
+				f.Bool("non", true, "")
+				f.Bool("ja", false, "")
+				f.Bool("yes", false, "")
+			},
+			env: []string{"OUI=Oui", "NON=NON", "JA=ja", "YES=yes"},
+			opts: []Option{
+				BoolLocale(map[string]bool{"oui": true}, map[string]bool{"non": true}),
+				BoolLocale(map[string]bool{"Ja": true}, map[string]bool{"nein": true}),
+			},
+			wantFlags: map[string]string{"oui": "true", "non": "false", "ja": "true", "yes": "true"},
+		},
+		{
+			desc:    "bool_locale_conflict",
+			init:    func(f *flag.FlagSet) { f.Bool("b", false, "") },
+			opts:    []Option{BoolLocale(map[string]bool{"si": true}, map[string]bool{"SI": true})},
+			wantErr: true,
+		},
+		{
+			desc: "require_unless_default",
+			init: func(f *flag.FlagSet) {
+				f.Int("arg", 1, "")
+				f.Int("env", 2, "")
+			},
+			args:      []string{"--arg=1"},
+			env:       []string{"ENV=2"},
+			opts:      []Option{RequireUnlessDefault("arg", "env")},
+			wantFlags: map[string]string{"arg": "1", "env": "2"},
+		},
+		{
+			desc:    "require_unless_default_missing",
+			init:    func(f *flag.FlagSet) { f.Int("port", 80, "") },
+			opts:    []Option{RequireUnlessDefault("port")},
+			wantErr: true,
+		},
+		{
+			desc: "require_source",
+			init: func(f *flag.FlagSet) {
+				f.String("token", "", "")
+				f.String("host", "", "")
+			},
+			args:      []string{"--host=example.com"},
+			env:       []string{"TOKEN=secret"},
+			opts:      []Option{RequireSource("token", SourceEnv), RequireSource("host", SourceArg)},
+			wantFlags: map[string]string{"token": "secret", "host": "example.com"},
+		},
+		{
+			desc:    "require_source_mismatch",
+			init:    func(f *flag.FlagSet) { f.String("token", "", "") },
+			args:    []string{"--token=secret"},
+			opts:    []Option{RequireSource("token", SourceEnv)},
+			wantErr: true,
+		},
+		{
+			desc: "require_source_order",
+			init: func(f *flag.FlagSet) {
+				f.String("a", "", "")
+				f.String("b", "", "")
+				f.String("c", "", "")
+			},
+			args: []string{"-a=x", "-b=x", "-c=x"},
+			opts: []Option{RequireSource("c", SourceEnv), RequireSource("aa", SourceEnv),
+				RequireSource("a", SourceEnv), RequireSource("b", SourceEnv)},
+			wantErr: true,
+			wantErrMsg: "envflag: flag -a must be set from env, but was set from arg\n" +
+				"envflag: flag -b must be set from env, but was set from arg\n" +
+				"envflag: flag -c must be set from env, but was set from arg",
+		},
+		{
+			desc: "key_chain",
+			init: func(f *flag.FlagSet) {
+				f.String("a", "", "")
+				f.String("b", "", "")
+				f.String("c", "", "")
+			},
+			env: []string{
+				"APP_A=prefixed", "A_LEGACY=absolute",
+				"APP_NEW_B=relative", "B_LEGACY=absolute",
+				"APP_C=ignored",
+			},
+			prefix: "APP_",
+			opts: []Option{
+				KeyChain("a", "new.a", "/A_LEGACY", "a"),
+				KeyChain("b", "new.b", "/B_LEGACY"),
+				KeyChain("c", "/C_LEGACY"),
+			},
+			wantFlags: map[string]string{"a": "absolute", "b": "relative", "c": ""},
+		},
+		{
+			desc: "prefix_when",
+			init: func(f *flag.FlagSet) { f.Int("port", 0, "") },
+			env:  []string{"APP_PORT=1", "CI_PORT=2", "DEV_PORT=3"},
+			opts: []Option{
+				Prefix("APP_"),
+				PrefixWhen(func() bool { return false }, "DEV_"),
+				PrefixWhen(func() bool { return true }, "CI_"),
+				PrefixWhen(func() bool { return true }, "DEV_"),
+			},
+			wantFlags: map[string]string{"port": "2"},
+		},
+		{
+			desc: "prefix_when_fallback",
+			init: func(f *flag.FlagSet) { f.Int("port", 0, "") },
+			env:  []string{"APP_PORT=1", "CI_PORT=2"},
+			opts: []Option{
+				PrefixWhen(func() bool { return false }, "CI_"),
+				Prefix("APP_"),
+			},
+			wantFlags: map[string]string{"port": "1"},
+		},
+		{
+			desc: "mutually_exclusive",
+			init: func(f *flag.FlagSet) {
+				f.Bool("use-tls", false, "")
+				f.Bool("insecure", false, "")
+				f.Bool("debug", false, "")
+			},
+			args:      []string{"--insecure=false", "--debug"},
+			env:       []string{"USE_TLS=true"},
+			opts:      []Option{MutuallyExclusive("use-tls", "insecure"), MutuallyExclusive("insecure", "debug")},
+			wantFlags: map[string]string{"use-tls": "true", "insecure": "false", "debug": "true"},
+		},
+		{
+			desc: "mutually_exclusive_conflict",
+			init: func(f *flag.FlagSet) {
+				f.Bool("use-tls", false, "")
+				f.Bool("insecure", false, "")
+			},
+			args:    []string{"--insecure"},
+			env:     []string{"USE_TLS=true"},
+			opts:    []Option{MutuallyExclusive("use-tls", "insecure")},
+			wantErr: true,
+		},
+		{
+			desc: "lines_values",
+			init: func(f *flag.FlagSet) {
+				f.Var(&stringList{}, "hosts", "")
+				f.Var(&stringList{}, "ports", "")
+			},
+			env:       []string{"HOSTS=a.example.com\n  b.example.com \r\n\nc.example.com\n", "PORTS=80\n443"},
+			opts:      []Option{LinesValues("hosts")},
+			wantFlags: map[string]string{"hosts": "a.example.com,b.example.com,c.example.com", "ports": "80\n443"},
+		},
+		{
+			desc: "warn_placeholders",
+			init: func(f *flag.FlagSet) {
+				f.String("port", "", "")
+				f.String("host", "", "")
+			},
+			env:        []string{"PORT={{ .Port }}", "HOST=%HOST%"},
+			opts:       []Option{WarnPlaceholders()},
+			wantFlags:  map[string]string{"port": "{{ .Port }}", "host": "%HOST%"},
+			wantOutput: "envflag: flag -port: PORT has unrendered placeholder: \"{{ .Port }}\"\n",
+		},
+		{
+			desc:       "warn_placeholders_patterns",
+			init:       func(f *flag.FlagSet) { f.String("host", "", "") },
+			env:        []string{"HOST=%HOST%"},
+			opts:       []Option{WarnPlaceholders(regexp.MustCompile(`^%\w+%$`))},
+			wantFlags:  map[string]string{"host": "%HOST%"},
+			wantOutput: "envflag: flag -host: HOST has unrendered placeholder",
+		},
+		{
+			desc:    "reject_placeholders",
+			init:    func(f *flag.FlagSet) { f.String("port", "", "") },
+			env:     []string{"PORT={{ .Port }}"},
+			opts:    []Option{RejectPlaceholders()},
+			wantErr: true,
+		},
+		{
+			desc:      "acronym_aware",
+			init:      func(f *flag.FlagSet) { f.String("apiKeyID", "", "") },
+			env:       []string{"APP_API_KEY_ID=key", "APP_APIKEYID=wrong"},
+			prefix:    "APP_",
+			opts:      []Option{AcronymAware()},
+			wantFlags: map[string]string{"apiKeyID": "key"},
+		},
+		{
+			desc: "assert_types",
+			init: func(f *flag.FlagSet) {
+				f.String("port", "", "")
+				f.String("timeout", "", "")
+			},
+			env:       []string{"PORT=0x50", "TIMEOUT=1m"},
+			opts:      []Option{AssertTypes(map[string]string{"port": "int", "timeout": "duration"})},
+			wantFlags: map[string]string{"port": "0x50", "timeout": "1m"},
+		},
+		{
+			desc:    "assert_types_mismatch",
+			init:    func(f *flag.FlagSet) { f.String("port", "", "") },
+			env:     []string{"PORT=http"},
+			opts:    []Option{AssertTypes(map[string]string{"port": "int"})},
+			wantErr: true,
+		},
+		{
+			desc:    "assert_types_unknown",
+			init:    func(f *flag.FlagSet) { f.String("port", "", "") },
+			opts:    []Option{AssertTypes(map[string]string{"port": "integer"})},
+			wantErr: true,
+		},
+		{
+			desc: "trim_space",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 0, "")
+				f.String("name", "", "")
+			},
+			args:      []string{"--name= arg "},
+			env:       []string{"PORT= 8080\r\n", "NAME= env "},
+			opts:      []Option{TrimSpace()},
+			wantFlags: map[string]string{"port": "8080", "name": " arg "},
+		},
+		{
+			desc:       "trim_space_default",
+			init:       func(f *flag.FlagSet) { f.Int("port", 0, "") },
+			env:        []string{"PORT=8080\n"},
+			wantErr:    true,
+			wantErrMsg: `envflag: invalid value "8080\n" for flag -port from PORT: parse error`,
+		},
+		{
+			desc: "trim_space_newline",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 0, "")
+				f.Duration("timeout", 0, "")
+			},
+			env:       []string{"PORT=8080\n", "TIMEOUT=\t5s\n"},
+			opts:      []Option{TrimSpace()},
+			wantFlags: map[string]string{"port": "8080", "timeout": "5s"},
+		},
+		{
+			desc: "empty_means_unset",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 80, "")
+				f.Duration("timeout", 1e9, "")
+				f.String("name", "default", "")
+				f.Bool("debug", false, "")
+				f.String("host", "", "")
+			},
+			env:       []string{"PORT=", "TIMEOUT=", "NAME=", "DEBUG=", "APP_HOST=", "HOST=fallback"},
+			opts:      []Option{EmptyMeansUnset(), Prefixes("APP_", ""), BoolByPresence()},
+			wantFlags: map[string]string{"port": "80", "timeout": "1s", "name": "default", "debug": "false", "host": "fallback"},
+		},
+		{
+			desc: "empty_means_unset_named",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 80, "")
+				f.String("name", "default", "")
+			},
+			env:       []string{"PORT=", "NAME="},
+			opts:      []Option{EmptyMeansUnset("port")},
+			wantFlags: map[string]string{"port": "80", "name": ""},
+		},
+		{
+			desc:       "empty_set_by_default",
+			init:       func(f *flag.FlagSet) { f.Int("port", 80, "") },
+			env:        []string{"PORT="},
+			wantErr:    true,
+			wantErrMsg: `envflag: invalid value "" for flag -port from PORT: parse error`,
+		},
+		{
+			desc: "trim_flags",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 0, "")
+				f.String("name", "", "")
+			},
+			env:       []string{"PORT=8080\r", "NAME= env "},
+			opts:      []Option{TrimFlags("port")},
+			wantFlags: map[string]string{"port": "8080", "name": " env "},
+		},
+		{
+			desc: "static_mapping",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.String("log-level", "", "")
+				f.String("other", "", "")
+			},
+			env:       []string{"LOG_LEVEL=a", "LOG__LEVEL=b", "APP_OTHER=c"},
+			prefix:    "APP_",
+			opts:      []Option{StaticMapping(map[string]string{"log.level": "LOG_LEVEL", "log-level": "LOG__LEVEL"}, false)},
+			wantFlags: map[string]string{"log.level": "a", "log-level": "b", "other": ""},
+		},
+		{
+			desc:      "static_mapping_fallback",
+			init:      func(f *flag.FlagSet) { f.String("other", "", "") },
+			env:       []string{"APP_OTHER=c"},
+			prefix:    "APP_",
+			opts:      []Option{StaticMapping(map[string]string{"log.level": "LOG_LEVEL"}, true)},
+			wantFlags: map[string]string{"other": "c"},
+		},
+		{
+			desc: "warn_limit",
+			init: func(f *flag.FlagSet) {
+				f.String("a", "", "")
+				f.String("b", "", "")
+				f.String("c", "", "")
+			},
+			env:        []string{"A={{ .A }}", "B={{ .B }}", "C=x,y"},
+			opts:       []Option{WarnPlaceholders(), WarnValueFormat("c", isList, "use a JSON array"), WarnLimit(1)},
+			wantFlags:  map[string]string{"a": "{{ .A }}", "b": "{{ .B }}", "c": "x,y"},
+			wantOutput: "\nenvflag: ...and 2 more warnings\n",
+		},
+		{
+			desc: "platform_default",
+			init: func(f *flag.FlagSet) {
+				f.String("socket", "/var/run/app.sock", "")
+				f.String("other", "/tmp/other", "")
+				f.String("env", "", "")
+				f.String("arg", "", "")
+			},
+			args: []string{"--arg=arg"},
+			env:  []string{"ENV=env"},
+			opts: []Option{
+				PlatformDefault("socket", map[string]string{runtime.GOOS: "platform"}),
+				PlatformDefault("other", map[string]string{"plan9": "platform"}),
+				PlatformDefault("env", map[string]string{runtime.GOOS: "platform"}),
+				PlatformDefault("arg", map[string]string{runtime.GOOS: "platform"}),
+			},
+			wantFlags: map[string]string{"socket": "platform", "other": "/tmp/other", "env": "env", "arg": "arg"},
+		},
+		{
+			desc: "require_non_empty",
+			init: func(f *flag.FlagSet) {
+				f.String("a", "", "")
+				f.String("b", "default", "")
+				f.String("c", "", "")
+				f.String("d", "", "")
+			},
+			args:       []string{"-d="},
+			env:        []string{"B=", "C=x"},
+			opts:       []Option{RequireNonEmpty("a", "b", "c", "d")},
+			wantErr:    true,
+			wantErrMsg: "envflag: flags must not be empty: -a, -b, -d",
+		},
+		{
+			desc: "int_base",
+			init: func(f *flag.FlagSet) {
+				f.Int("hex", 0, "")
+				f.Int64("oct", 0, "")
+				f.Uint("bin", 0, "")
+				f.Int("neg", 0, "")
+				f.Int("dec", 0, "")
+				f.Int("arg", 0, "")
+			},
+			args:      []string{"-arg=10"},
+			env:       []string{"HEX=0xFF", "OCT=0o755", "BIN=0b1010_1010", "NEG=-0x10", "DEC=010"},
+			opts:      []Option{IntBase("hex", "oct", "bin", "neg", "dec", "arg")},
+			wantFlags: map[string]string{"hex": "255", "oct": "493", "bin": "170", "neg": "-16", "dec": "10", "arg": "10"},
+		},
+		{
+			desc:       "int_base_invalid",
+			init:       func(f *flag.FlagSet) { f.Uint("mask", 0, "") },
+			env:        []string{"MASK=0xZZ"},
+			opts:       []Option{IntBase("mask")},
+			wantErr:    true,
+			wantErrMsg: `envflag: flag -mask: MASK: invalid integer "0xZZ"`,
+		},
+		{
+			desc: "reject_leading_zeros",
+			init: func(f *flag.FlagSet) {
+				f.Int("zero", 1, "")
+				f.Float64("frac", 0, "")
+				f.Int("hex", 0, "")
+				f.Int("arg", 0, "")
+				f.Int("other", 0, "")
+			},
+			args:      []string{"-arg=010"},
+			env:       []string{"ZERO=0", "FRAC=0.5", "HEX=0x10", "OTHER=010"},
+			opts:      []Option{RejectLeadingZeros("zero", "frac", "hex", "arg")},
+			wantFlags: map[string]string{"zero": "0", "frac": "0.5", "hex": "16", "arg": "8", "other": "8"},
+		},
+		{
+			desc:       "reject_leading_zeros_invalid",
+			init:       func(f *flag.FlagSet) { f.Int("port", 0, "") },
+			env:        []string{"PORT=-08"},
+			opts:       []Option{RejectLeadingZeros("port")},
+			wantErr:    true,
+			wantErrMsg: `envflag: flag -port: PORT: leading zero in value "-08"`,
+		},
+		{
+			desc: "strip_inline_comments",
+			init: func(f *flag.FlagSet) {
+				f.Int("port", 0, "")
+				f.String("color", "", "")
+				f.String("note", "", "")
+				f.String("arg", "", "")
+			},
+			args:      []string{"-arg=a # b"},
+			env:       []string{"PORT=8080 ;; default", `COLOR="#fff" ;; ignored`, "NOTE='a ;; b'c;;d"},
+			opts:      []Option{StripInlineComments(";;")},
+			wantFlags: map[string]string{"port": "8080", "color": `"#fff"`, "note": "'a ;; b'c", "arg": "a # b"},
+		},
+		{
+			desc: "name_mapper",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.Bool("debugMode", false, "")
+			},
+			env:    []string{"MYAPP__LOG__LEVEL=debug", "MYAPP__debugMode=yes", "MYAPP_LOG_LEVEL=info"},
+			prefix: "MYAPP__",
+			opts: []Option{NameMapper(func(name string) string {
+				if name == "debugMode" {
+					return name
+				}
+				return strings.Replace(strings.ToUpper(name), ".", "__", -1)
+			})},
+			wantFlags: map[string]string{"log.level": "debug", "debugMode": "true"},
+		},
+		{
+			desc: "names",
+			init: func(f *flag.FlagSet) {
+				f.String("config.path", "", "")
+				f.String("fallback", "", "")
+				f.String("other", "", "")
+			},
+			env:    []string{"APP_CONFIG_FILE=a", "APP_CONFIG_PATH=b", "APP_FALLBACK=c", "APP_OTHER=d"},
+			prefix: "APP_",
+			opts: []Option{Names(map[string]string{
+				"config.path": "APP_CONFIG_FILE",
+				"fallback":    "LEGACY_FALLBACK",
+			}, true)},
+			wantFlags: map[string]string{"config.path": "a", "fallback": "c", "other": "d"},
+		},
+		{
+			desc: "names_no_fallback",
+			init: func(f *flag.FlagSet) {
+				f.String("fallback", "", "")
+			},
+			env:       []string{"FALLBACK=c"},
+			opts:      []Option{Names(map[string]string{"fallback": "LEGACY_FALLBACK"}, false)},
+			wantFlags: map[string]string{"fallback": ""},
+		},
+		{
+			desc: "split_values",
+			init: func(f *flag.FlagSet) {
+				f.Var(&stringList{}, "tags", "")
+				f.Var(&stringList{}, "paths", "")
+				f.Var(&stringList{}, "arg", "")
+				f.String("other", "", "")
+			},
+			args: []string{"-arg=a,b"},
+			env:  []string{`TAGS=a\,b,c\\`, "PATHS=/bin::/usr/bin", "OTHER=x,y"},
+			opts: []Option{
+				SplitValues("", "tags", "arg", "other"),
+				SplitValues("::", "paths"),
+			},
+			wantFlags: map[string]string{"tags": `a,b,c\`, "paths": "/bin,/usr/bin", "arg": "a,b", "other": "y"},
+		},
+		{
+			desc: "strip_redundant_prefix",
+			init: func(f *flag.FlagSet) {
+				f.String("app.log.level", "", "")
+				f.String("log.format", "", "")
+				f.Int("port", 0, "")
+			},
+			env:       []string{"APP_LOG_LEVEL=debug", "APP_APP_LOG_LEVEL=wrong", "APP_LOG_FORMAT=json", "APP_PORT=80"},
+			prefix:    "APP_",
+			opts:      []Option{StripRedundantPrefix()},
+			wantFlags: map[string]string{"app.log.level": "debug", "log.format": "json", "port": "80"},
+		},
+		{
+			desc: "default_keyword",
+			init: func(f *flag.FlagSet) {
+				f.Int("workers", -1, "")
+				f.String("mode", "auto", "")
+				f.Bool("debug", true, "")
+				f.String("name", "x", "")
+			},
+			args:      []string{"-name=default"},
+			env:       []string{"WORKERS=Default", "MODE=default", "DEBUG=default"},
+			opts:      []Option{DefaultKeyword("default"), Defaults(map[string]string{"workers": "4"})},
+			wantFlags: map[string]string{"workers": "-1", "mode": "auto", "debug": "true", "name": "default"},
+		},
+		{
+			desc: "default_keyword_priority",
+			init: func(f *flag.FlagSet) {
+				f.Int("workers", -1, "")
+			},
+			args:      []string{"-workers=8"},
+			env:       []string{"WORKERS=auto"},
+			opts:      []Option{DefaultKeyword("auto"), FlagPriority("workers", SourceEnv)},
+			wantFlags: map[string]string{"workers": "-1"},
+		},
+		{
+			desc: "indexed_lists",
+			init: func(f *flag.FlagSet) {
+				f.Var(&stringList{}, "endpoint", "")
+				f.Var(&stringList{}, "host", "")
+				f.Var(&stringList{}, "tag", "")
+			},
+			env:    []string{"APP_ENDPOINT_1=b,c", "APP_ENDPOINT_0=a", "APP_ENDPOINT_3=d", "APP_HOST=x", "APP_TAG__0=y"},
+			prefix: "APP_",
+			opts: []Option{
+				IndexedLists("endpoint", "host"),
+				IndexedLists("tag"),
+				Names(map[string]string{"tag": "APP_TAG_"}, false),
+			},
+			wantFlags: map[string]string{"endpoint": "a,b,c", "host": "x", "tag": "y"},
+		},
+		{
+			desc:       "indexed_lists_strict",
+			init:       func(f *flag.FlagSet) { f.Var(&stringList{}, "endpoint", "") },
+			env:        []string{"APP_ENDPOINT_0=a", "APP_ENDPOINT_2=c"},
+			prefix:     "APP_",
+			opts:       []Option{IndexedLists("endpoint"), Strict()},
+			wantErr:    true,
+			wantErrMsg: "envflag: unrecognized environment variables: APP_ENDPOINT_2",
+		},
+		{
+			desc: "all_errors",
+			init: func(f *flag.FlagSet) {
+				f.Int("a", 0, "")
+				f.Int("b", 0, "")
+				f.Int("c", 0, "")
+			},
+			env:        []string{"APP_A=x", "APP_B=1", "APP_C=y"},
+			prefix:     "APP_",
+			opts:       []Option{AllErrors()},
+			wantErr:    true,
+			wantErrMsg: "envflag: invalid value \"x\" for flag -a from APP_A: parse error\nenvflag: invalid value \"y\" for flag -c from APP_C: parse error",
+		},
+		{
+			desc: "bool_values",
+			init: func(f *flag.FlagSet) {
+				f.Bool("a", false, "")
+				f.Bool("b", true, "")
+				f.Bool("c", false, "")
+				f.Bool("d", true, "")
+			},
+			env:       []string{"A=ON", "B=Disabled", "C=true", "D=Non"},
+			opts:      []Option{BoolValues([]string{"on", "enabled"}, []string{"off", "disabled"}), BoolLocale(nil, map[string]bool{"non": true})},
+			wantFlags: map[string]string{"a": "true", "b": "false", "c": "true", "d": "false"},
+		},
+		{
+			desc:       "bool_values_invalid",
+			init:       func(f *flag.FlagSet) { f.Bool("a", false, "") },
+			env:        []string{"A=yes"},
+			opts:       []Option{BoolValues([]string{"on"}, []string{"off"})},
+			wantErr:    true,
+			wantErrMsg: `envflag: invalid value "yes" for flag -a from A: parse error; accepted values: on (true), off (false)`,
+		},
+		{
+			desc:    "bool_values_conflict",
+			init:    func(f *flag.FlagSet) { f.Bool("a", false, "") },
+			opts:    []Option{BoolValues([]string{"on"}, []string{"ON"})},
+			wantErr: true,
+		},
+		{
+			desc: "expand_values",
+			init: func(f *flag.FlagSet) {
+				f.String("cache_dir", "", "")
+				f.String("missing", "", "")
+				f.String("arg", "", "")
+			},
+			args:      []string{"-arg=${HOME}"},
+			env:       []string{"HOME=/home/app", "CACHE_DIR=${HOME}/cache", "MISSING=$NOPE/x"},
+			opts:      []Option{ExpandValues(false)},
+			wantFlags: map[string]string{"cache_dir": "/home/app/cache", "missing": "${NOPE}/x", "arg": "${HOME}"},
+		},
+		{
+			desc:       "expand_values_strict",
+			init:       func(f *flag.FlagSet) { f.String("missing", "", "") },
+			env:        []string{"MISSING=$NOPE/${ALSO_NOPE}"},
+			opts:       []Option{ExpandValues(true)},
+			wantErr:    true,
+			wantErrMsg: "envflag: flag -missing: MISSING: undefined variables: NOPE, ALSO_NOPE",
+		},
+		{
+			desc: "preserve_case",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.String("Mixed-Case", "", "")
+			},
+			env:       []string{"app_log_level=debug", "APP_LOG_LEVEL=info", "app_Mixed_Case=x"},
+			prefix:    "app_",
+			opts:      []Option{PreserveCase()},
+			wantFlags: map[string]string{"log.level": "debug", "Mixed-Case": "x"},
+		},
+		{
+			desc: "aliases",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.String("db.host", "", "")
+				f.String("port", "", "")
+			},
+			env:    []string{"LOGLEVEL=debug", "APP_LOG_LEVEL=info", "OLD_DB_HOST=x", "APP_PORT=80"},
+			prefix: "APP_",
+			opts: []Option{Aliases(map[string][]string{
+				"log.level": {"OLD_LOG_LEVEL", "LOGLEVEL"},
+				"db.host":   {"OLD_DB_HOST"},
+				"port":      {"OLD_PORT"},
+			}), WarnAliases()},
+			wantFlags:  map[string]string{"log.level": "debug", "db.host": "x", "port": "80"},
+			wantOutput: "envflag: flag -db.host: OLD_DB_HOST is deprecated; use APP_DB_HOST\n",
+		},
+		{
+			desc: "prefixes",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.String("port", "", "")
+				f.String("host", "", "")
+			},
+			env: []string{
+				"BRANDA_LOG_LEVEL=debug", "COMMON_LOG_LEVEL=info", "LOG_LEVEL=warn",
+				"COMMON_PORT=80", "PORT=8080",
+				"HOST=example.com",
+			},
+			prefix:    "IGNORED_",
+			opts:      []Option{Prefixes("BRANDA_", "COMMON_", "")},
+			wantFlags: map[string]string{"log.level": "debug", "port": "80", "host": "example.com"},
+		},
+		{
+			desc: "exact_case",
+			init: func(f *flag.FlagSet) {
+				f.String("Path", "", "")
+				f.String("log.level", "", "")
+				f.String("home", "", "")
+			},
+			env:       []string{"PATH=/bin", "Path=x", "log.level=debug", "LOG_LEVEL=info", "HOME=/root"},
+			opts:      []Option{ExactCase()},
+			wantFlags: map[string]string{"Path": "x", "log.level": "debug", "home": ""},
+		},
+		{
+			desc: "deprecate",
+			init: func(f *flag.FlagSet) {
+				f.String("log.level", "", "")
+				f.String("port", "", "")
+			},
+			env: []string{"LOGLEVEL=debug", "OLD_PORT=1", "PORT=80"},
+			opts: []Option{
+				Aliases(map[string][]string{"log.level": {"LOGLEVEL"}, "port": {"OLD_PORT"}}),
+				KeyChain("port", "port", "/OLD_PORT"),
+				Deprecate("LOGLEVEL", "use LOG_LEVEL"),
+				Deprecate("OLD_PORT", "use PORT"),
+			},
+			wantFlags:  map[string]string{"log.level": "debug", "port": "1"},
+			wantOutput: "envflag: flag -log.level: LOGLEVEL is deprecated: use LOG_LEVEL\nenvflag: flag -port: OLD_PORT is deprecated: use PORT\n",
+		},
+		{
+			desc: "fuzzy_names",
+			init: func(f *flag.FlagSet) {
+				f.String("log-level", "", "")
+				f.String("db-host", "", "")
+				f.String("db-port", "", "")
+				f.String("user", "", "")
+			},
+			env: []string{
+				"APP_LOG_LEVEL=a", "log-level=b", "LOG_LEVEL=c",
+				"db-host=b", "DB_HOST=c",
+				"DB_PORT=c",
+			},
+			prefix:    "APP_",
+			opts:      []Option{FuzzyNames()},
+			wantFlags: map[string]string{"log-level": "a", "db-host": "b", "db-port": "c", "user": ""},
+		},
+		{
+			desc: "bool_by_presence",
+			init: func(f *flag.FlagSet) {
+				f.Bool("feature-x", false, "")
+				f.Bool("feature-y", false, "")
+				f.Bool("feature-z", true, "")
+				f.Bool("other", false, "")
+				f.String("name", "", "")
+			},
+			env:       []string{"FEATURE_X=", "FEATURE_Y=false", "OTHER=false", "NAME="},
+			opts:      []Option{BoolByPresence("feature-x", "feature-y", "feature-z", "name")},
+			wantFlags: map[string]string{"feature-x": "true", "feature-y": "true", "feature-z": "true", "other": "false", "name": ""},
+		},
+		{
+			desc: "bool_by_presence_all",
+			init: func(f *flag.FlagSet) {
+				f.Bool("feature-x", false, "")
+				f.Bool("other", false, "")
+			},
+			env:       []string{"FEATURE_X=no"},
+			opts:      []Option{BoolByPresence()},
+			wantFlags: map[string]string{"feature-x": "true", "other": "false"},
+		},
+		{
+			desc:    "platform_default_invalid",
+			init:    func(f *flag.FlagSet) { f.Int("n", 0, "") },
+			opts:    []Option{PlatformDefault("n", map[string]string{runtime.GOOS: "x"})},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
@@ -149,11 +876,15 @@ func TestParse(t *testing.T) {
 			if tt.prefix != "" {
 				opts = append(opts, Prefix(tt.prefix))
 			}
+			opts = append(opts, tt.opts...)
 			if err := Parse(opts...); err != nil {
 				if !tt.wantErr {
 					t.Logf("Output:\n%s", w.Bytes())
 					t.Fatalf("unexpected error: %v", err)
 				}
+				if !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Errorf("error: want: %q; got: %q", tt.wantErrMsg, err)
+				}
 				return
 			}
 			if tt.wantErr {
@@ -167,10 +898,334 @@ func TestParse(t *testing.T) {
 			if args := set.Args(); len(args)+len(tt.wantArgs) > 0 && !reflect.DeepEqual(tt.wantArgs, args) {
 				t.Errorf("args: want: %v; got: %v", tt.wantArgs, args)
 			}
+			if out := w.String(); !strings.Contains(out, tt.wantOutput) {
+				t.Errorf("output: want: %q; got: %q", tt.wantOutput, out)
+			}
 		})
 	}
 }
 
+func TestPlatformDefault(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"ARGS_ONLY=env", "OFF=1"})
+	set := flag.NewFlagSet("platform", flag.ContinueOnError)
+	var usage bytes.Buffer
+	set.SetOutput(&usage)
+	argsOnly := set.String("args-only", "registered", "")
+	killed := set.String("killed", "registered", "")
+	platform := map[string]string{runtime.GOOS: "platform"}
+	opts := []Option{FlagSet(set), Args(nil), ArgsOnly("args-only"), PlatformDefault("args-only", platform), PlatformDefault("killed", platform)}
+	if err := Parse(opts...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *argsOnly != "platform" || *killed != "platform" {
+		t.Errorf("unexpected values: args-only=%q killed=%q", *argsOnly, *killed)
+	}
+	if err := Parse(append(opts, KillSwitch("OFF"))...); err != nil {
+		t.Fatalf("kill switch: unexpected error: %v", err)
+	}
+	if *killed != "platform" {
+		t.Errorf("kill switch: killed: want: %q; got: %q", "platform", *killed)
+	}
+	if f := set.Lookup("killed"); f.DefValue != "registered" {
+		t.Errorf("DefValue: want: %q; got: %q", "registered", f.DefValue)
+	}
+	set.Usage()
+	if !strings.Contains(usage.String(), `(default "platform")`) || strings.Contains(usage.String(), "registered") {
+		t.Errorf("unexpected usage: %q", usage.String())
+	}
+	if f := set.Lookup("killed"); f.DefValue != "registered" {
+		t.Errorf("DefValue after usage: want: %q; got: %q", "registered", f.DefValue)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"B=invalid_int"})
+	set := flag.NewFlagSet("atomic", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	a := set.Int("a", 1, "")
+	b := set.Int("b", 2, "")
+	s := set.String("s", "x", "")
+	if err := set.Set("s", "preset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Parse(FlagSet(set), Args([]string{"--a=10", "--s=y"}), Atomic()); err == nil {
+		t.Fatal("expected error")
+	}
+	if *a != 1 || *b != 2 || *s != "preset" {
+		t.Errorf("flags not restored: a=%d b=%d s=%q", *a, *b, *s)
+	}
+}
+
+// nonEmpty is a flag value which rejects the empty string.
+type nonEmpty string
+
+func (v *nonEmpty) String() string { return string(*v) }
+
+func (v *nonEmpty) Set(s string) error {
+	if s == "" {
+		return errors.New("empty value")
+	}
+	*v = nonEmpty(s)
+	return nil
+}
+
+func TestAtomicRestoreError(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=x", "B=invalid_int"})
+	set := flag.NewFlagSet("atomic", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	var a nonEmpty
+	set.Var(&a, "a", "")
+	set.Int("b", 2, "")
+	err := Parse(FlagSet(set), Args(nil), Atomic())
+	if err == nil || !strings.Contains(err.Error(), "\nenvflag: restoring flag -a: empty value") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDetectShadows(t *testing.T) {
+	a := flag.NewFlagSet("a", flag.ContinueOnError)
+	a.Int("port", 0, "")
+	a.String("host", "", "")
+	b := flag.NewFlagSet("b", flag.ContinueOnError)
+	b.Int("port", 0, "")
+	c := flag.NewFlagSet("c", flag.ContinueOnError)
+	c.Int("port", 0, "")
+	c.String("user", "", "")
+
+	if err := Parse(FlagSet(a), Args(nil), DetectShadows(c)); err == nil {
+		t.Fatal("expected error")
+	} else if want := "-port (a, c)"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error: want: %q; got: %q", want, err)
+	}
+	if err := Parse(FlagSet(b), Args(nil), DetectShadows(a, c)); err == nil {
+		t.Fatal("expected error")
+	} else if want := "-port (b, a, c)"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error: want: %q; got: %q", want, err)
+	}
+	d := flag.NewFlagSet("d", flag.ContinueOnError)
+	d.String("name", "", "")
+	if err := Parse(FlagSet(d), Args(nil), DetectShadows(a)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFlagSets(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_PORT=80", "APP_USER=env", "APP_LEVEL=debug"})
+	server := flag.NewFlagSet("server", flag.ContinueOnError)
+	server.SetOutput(bytes.NewBuffer(nil))
+	port := server.Int("port", 0, "")
+	host := server.String("host", "localhost", "")
+	db := flag.NewFlagSet("db", flag.ContinueOnError)
+	user := db.String("user", "", "")
+	level := db.String("level", "info", "")
+	res, err := ParseWithResult(FlagSets(server, db), Prefix("APP_"), Args([]string{"-user=arg", "serve", "-host=x"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 80 || *host != "localhost" || *user != "arg" || *level != "debug" {
+		t.Errorf("unexpected values: port=%d host=%q user=%q level=%q", *port, *host, *user, *level)
+	}
+	if want := []string{"serve", "-host=x"}; !reflect.DeepEqual(res.Args, want) {
+		t.Errorf("args: want: %q; got: %q", want, res.Args)
+	}
+	if want := map[string]Source{"port": SourceEnv, "host": SourceDefault, "user": SourceArg, "level": SourceEnv}; !reflect.DeepEqual(res.Sources, want) {
+		t.Errorf("sources: want: %v; got: %v", want, res.Sources)
+	}
+
+	other := flag.NewFlagSet("other", flag.ContinueOnError)
+	other.Int("port", 0, "")
+	err = Parse(FlagSets(server, db, other), Args(nil))
+	if want := "envflag: flags defined in multiple sets: -port (server, other)"; err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+}
+
+var errInvalid = errors.New("invalid")
+
+type invalidValue struct{}
+
+func (invalidValue) String() string     { return "" }
+func (invalidValue) Set(v string) error { return errInvalid }
+
+func TestEnvError(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_A=x", "APP_B=y", "APP_TOKEN=hunter2"})
+	for _, opts := range [][]Option{nil, {AllErrors()}} {
+		set := flag.NewFlagSet("env_error", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.Var(invalidValue{}, "a", "")
+		set.Var(invalidValue{}, "b", "")
+		err := Parse(append(opts, FlagSet(set), Prefix("APP_"), Args(nil))...)
+		var e *EnvError
+		if !errors.As(err, &e) {
+			t.Fatalf("want *EnvError; got: %v", err)
+		}
+		if e.Flag != "a" || e.EnvKey != "APP_A" || e.Value != "x" || !errors.Is(err, errInvalid) {
+			t.Errorf("unexpected error: %#v", e)
+		}
+		if want := `envflag: invalid value "x" for flag -a from APP_A: invalid`; e.Error() != want {
+			t.Errorf("message: want: %q; got: %q", want, e.Error())
+		}
+	}
+
+	set := flag.NewFlagSet("env_error", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Bool("token", false, "")
+	err := Parse(FlagSet(set), Prefix("APP_"), Args(nil), Redact("token"))
+	var e *EnvError
+	if !errors.As(err, &e) || e.Value != "hunter2" || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	set = flag.NewFlagSet("env_error", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("port", 0, "")
+	err = Parse(FlagSet(set), Args(nil), Defaults(map[string]string{"port": "x"}))
+	if err == nil || errors.As(err, &e) {
+		t.Errorf("want non-EnvError; got: %v", err)
+	}
+}
+
+type counter int
+
+func (c *counter) String() string     { return strconv.Itoa(int(*c)) }
+func (c *counter) Set(v string) error { *c++; return nil }
+func (c *counter) IsBoolFlag() bool   { return true }
+
+func TestCountFlags(t *testing.T) {
+	defer resetEnv()()
+	tests := []struct {
+		env     string
+		args    []string
+		want    counter
+		wantErr string
+	}{
+		{env: "VERBOSE=3", want: 3},
+		{env: "VERBOSE=0", want: 0},
+		{env: "VERBOSE=5", args: []string{"-verbose", "-verbose"}, want: 2},
+		{env: "VERBOSE=-1", wantErr: `envflag: invalid value "-1" for flag -verbose from VERBOSE: count must be an integer from 0 to 65535`},
+		{env: "VERBOSE=yes", wantErr: `envflag: invalid value "yes" for flag -verbose from VERBOSE: count must be an integer from 0 to 65535`},
+		{env: "VERBOSE=65536", wantErr: `envflag: invalid value "65536" for flag -verbose from VERBOSE: count must be an integer from 0 to 65535`},
+	}
+	for _, tt := range tests {
+		setEnv([]string{tt.env})
+		set := flag.NewFlagSet("count", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		var c counter
+		set.Var(&c, "verbose", "")
+		err := Parse(FlagSet(set), Args(tt.args), CountFlags("verbose"))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error: want: %q; got: %v", tt.env, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.env, err)
+		} else if c != tt.want {
+			t.Errorf("%s: want: %d; got: %d", tt.env, tt.want, c)
+		}
+	}
+}
+
+// tristate is a bool flag which also accepts "auto" and any other value.
+type tristate struct {
+	v        string
+	noNormal bool
+}
+
+func (t *tristate) String() string       { return t.v }
+func (t *tristate) Set(v string) error   { t.v = v; return nil }
+func (t *tristate) IsBoolFlag() bool     { return true }
+func (t *tristate) NoEnvNormalize() bool { return t.noNormal }
+
+func TestRawBool(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=yes", "B=yes", "C=yes", "D=Y"})
+	set := flag.NewFlagSet("raw_bool", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	a, b, c := &tristate{}, &tristate{}, &tristate{noNormal: true}
+	set.Var(a, "a", "")
+	set.Var(b, "b", "")
+	set.Var(c, "c", "")
+	d := set.Bool("d", false, "")
+	if err := Parse(FlagSet(set), Args(nil), RawBool("b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.v != "true" || b.v != "yes" || c.v != "yes" || !*d {
+		t.Errorf("unexpected values: a=%q b=%q c=%q d=%v", a.v, b.v, c.v, *d)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"MODE= Fast ", "DATA=aGk=", "LEVEL=x", "TOKEN=bad"})
+	set := flag.NewFlagSet("transform", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	mode := set.String("mode", "", "")
+	data := set.String("data", "", "")
+	level := set.String("level", "", "")
+	set.String("token", "", "")
+	upper := func(s string) (string, error) { return strings.ToUpper(s), nil }
+	err := Parse(FlagSet(set), Args([]string{"-level=arg"}), TrimSpace(), Codec("data", "base64"), Transform(map[string]func(string) (string, error){
+		"mode":  func(s string) (string, error) { return strings.ToLower(s), nil },
+		"data":  upper,
+		"level": upper,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *mode != "fast" || *data != "HI" || *level != "arg" {
+		t.Errorf("unexpected values: mode=%q data=%q level=%q", *mode, *data, *level)
+	}
+
+	fail := func(s string) (string, error) { return "", errors.New("rejected " + s) }
+	set = flag.NewFlagSet("transform", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("token", "", "")
+	err = Parse(FlagSet(set), Args(nil), Redact("token"), Transform(map[string]func(string) (string, error){"token": fail}))
+	var e *EnvError
+	if !errors.As(err, &e) || e.Flag != "token" || e.EnvKey != "TOKEN" || e.Value != "bad" {
+		t.Fatalf("want *EnvError; got: %v", err)
+	}
+	if want := "envflag: invalid value [redacted] for flag -token from TOKEN: rejected [redacted]"; err.Error() != want {
+		t.Errorf("error: want: %q; got: %q", want, err)
+	}
+}
+
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+func TestRawValues(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"YES=Yes", "PORT= 80 ", "BAD=x", "ARG=env"})
+	set := flag.NewFlagSet("raw", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Bool("yes", false, "")
+	set.Bool("v", false, "")
+	set.Int("port", 0, "")
+	set.Int("bad", 0, "")
+	set.String("arg", "", "")
+	set.String("unset", "", "")
+	var raw map[string]string
+	err := Parse(FlagSet(set), Args([]string{"-v", "--arg", "a b", "pos"}), TrimSpace(), RawValues(&raw))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := map[string]string{"yes": "Yes", "v": "true", "port": " 80 ", "bad": "x", "arg": "a b"}
+	if !reflect.DeepEqual(raw, want) {
+		t.Errorf("want: %v; got: %v", want, raw)
+	}
+}
+
+func isList(s string) bool { return !strings.HasPrefix(s, "[") }
+
 func resetEnv() func() {
 	env := os.Environ()
 	os.Clearenv()
@@ -186,3 +1241,321 @@ func setEnv(env []string) {
 		os.Setenv(kv[0], kv[1])
 	}
 }
+
+func TestMustParse(t *testing.T) {
+	defer resetEnv()()
+	defer func(fn func(int)) { exit = fn }(exit)
+	code := -1
+	exit = func(c int) { code = c }
+	for _, tt := range []struct {
+		args       []string
+		env        []string
+		handling   flag.ErrorHandling
+		wantCode   int
+		wantOutput string
+		wantPanic  bool
+	}{
+		{args: nil, wantCode: -1},
+		{args: []string{"-h"}, wantCode: 0, wantOutput: "Usage of must:\n  -n int\n"},
+		{args: []string{"-n=x"}, wantCode: 2, wantOutput: "invalid value \"x\" for flag -n: parse error\nUsage"},
+		{env: []string{"N=1"}, args: []string{"-n=2"}, wantCode: -1},
+		{env: []string{"N=1"}, handling: flag.PanicOnError, wantCode: -1},
+		{env: []string{"N=9"}, wantCode: 2, wantOutput: "envflag: flag -n: value 9 out of range [0, 5]\n"},
+		{env: []string{"N=9"}, handling: flag.PanicOnError, wantPanic: true},
+	} {
+		os.Clearenv()
+		setEnv(tt.env)
+		code = -1
+		set := flag.NewFlagSet("must", tt.handling)
+		var out bytes.Buffer
+		set.SetOutput(&out)
+		set.Int("n", 0, "")
+		func() {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("args=%v env=%v: unexpected panic: %v", tt.args, tt.env, r)
+				}
+			}()
+			MustParse(FlagSet(set), Args(tt.args), Bounds("n", 0, 5))
+		}()
+		if tt.wantPanic {
+			continue
+		}
+		if code != tt.wantCode {
+			t.Errorf("args=%v env=%v: exit code: want: %d; got: %d", tt.args, tt.env, tt.wantCode, code)
+		}
+		if !strings.HasPrefix(out.String(), tt.wantOutput) || strings.Count(out.String(), "Usage") > 1 {
+			t.Errorf("args=%v env=%v: output: want prefix: %q; got: %q", tt.args, tt.env, tt.wantOutput, out.String())
+		}
+	}
+}
+
+type orderValue struct {
+	name  string
+	order *[]string
+}
+
+func (v *orderValue) String() string { return "" }
+
+func (v *orderValue) Set(s string) error {
+	*v.order = append(*v.order, v.name)
+	return nil
+}
+
+func TestParseOrder(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"D=x", "B=x", "C=x", "A=x", "Z=bad", "Y=bad", "X=bad"})
+	for i := 0; i < 10; i++ {
+		var order []string
+		set := flag.NewFlagSet("order", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		for _, name := range []string{"d", "b", "c", "a"} {
+			set.Var(&orderValue{name, &order}, name, "")
+		}
+		set.Int("z", 0, "")
+		set.Int("y", 0, "")
+		set.Int("x", 0, "")
+		err := Parse(FlagSet(set), Args(nil))
+		if err == nil || !strings.Contains(err.Error(), "-x") {
+			t.Fatalf("error: want -x; got: %v", err)
+		}
+		if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(order, want) {
+			t.Fatalf("order: want: %v; got: %v", want, order)
+		}
+	}
+}
+
+func TestOnEnvSet(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_V=yes", "APP_N=x", "APP_HOST=h", "VAR_A=1", "VAR_B=2"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	if err := os.WriteFile(path, []byte("APP_PORT=80\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("on_env_set", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Bool("v", false, "")
+	set.Int("n", 0, "")
+	set.String("host", "", "")
+	set.Int("port", 0, "")
+	set.Var(&StringMap{}, "vars", "")
+	var calls []string
+	err := Parse(FlagSet(set), Args([]string{"-host=x"}), Prefix("APP_"), EnvFile(path), EnvMap("vars", "VAR_"),
+		AllErrors(),
+		OnEnvSet(func(name, key, value string) {
+			calls = append(calls, name+" "+key+" "+value)
+		}),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := []string{"n APP_N x", "port APP_PORT 80", "v APP_V yes", "vars VAR_A 1", "vars VAR_B 2"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls: want: %q; got: %q", want, calls)
+	}
+}
+
+func TestParseErrorHandling(t *testing.T) {
+	defer resetEnv()()
+	defer func(fn func(int)) { exit = fn }(exit)
+	code := -1
+	exit = func(c int) { code = c }
+	setEnv([]string{"N=x"})
+	const want = "envflag: invalid value \"x\" for flag -n from N: parse error"
+	for _, tt := range []struct {
+		handling   flag.ErrorHandling
+		wantCode   int
+		wantOutput string
+		wantPanic  bool
+	}{
+		{handling: flag.ContinueOnError, wantCode: -1},
+		{handling: flag.ExitOnError, wantCode: 2, wantOutput: want + "\n"},
+		{handling: flag.PanicOnError, wantCode: -1, wantOutput: want + "\n", wantPanic: true},
+	} {
+		code = -1
+		set := flag.NewFlagSet("handling", tt.handling)
+		var out bytes.Buffer
+		set.SetOutput(&out)
+		set.Int("n", 0, "")
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("handling=%v: unexpected panic: %v", tt.handling, r)
+				}
+			}()
+			err = Parse(FlagSet(set), Args(nil))
+		}()
+		if !tt.wantPanic && (err == nil || err.Error() != want) {
+			t.Errorf("handling=%v: error: want: %q; got: %v", tt.handling, want, err)
+		}
+		if code != tt.wantCode {
+			t.Errorf("handling=%v: exit code: want: %d; got: %d", tt.handling, tt.wantCode, code)
+		}
+		if got := out.String(); got != tt.wantOutput {
+			t.Errorf("handling=%v: output: want: %q; got: %q", tt.handling, tt.wantOutput, got)
+		}
+	}
+}
+
+func TestWarnOutput(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"OLD=x"})
+	set := flag.NewFlagSet("warn_output", flag.ContinueOnError)
+	var out, warn bytes.Buffer
+	set.SetOutput(&out)
+	set.String("new", "", "")
+	err := Parse(FlagSet(set), Args(nil), KeyChain("new", "new", "/OLD"), Deprecate("OLD", "use NEW"), WarnOutput(&warn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "envflag: flag -new: OLD is deprecated: use NEW\n"; warn.String() != want {
+		t.Errorf("warnings: want: %q; got: %q", want, warn.String())
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestParseSubcommand(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_SERVE_PORT=8080", "APP_PORT=80", "APP_HOST=global", "APP_NAME=global", "SERVE_NAME=serve", "DEBUG=true"})
+	set := flag.NewFlagSet("serve", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	port := set.Int("port", 0, "")
+	host := set.String("host", "", "")
+	name := set.String("name", "", "")
+	err := ParseSubcommand("serve", set, Prefix("APP"), Args([]string{"-name=arg", "a", "b"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 8080 || *host != "global" || *name != "arg" {
+		t.Errorf("unexpected values: port=%d host=%q name=%q", *port, *host, *name)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(set.Args(), want) {
+		t.Errorf("args: want: %q; got: %q", want, set.Args())
+	}
+
+	set = flag.NewFlagSet("serve", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	name = set.String("name", "", "")
+	debug := set.Bool("debug", false, "")
+	if err := ParseSubcommand("serve", set, Args(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *name != "serve" || !*debug {
+		t.Errorf("unexpected values: name=%q debug=%v", *name, *debug)
+	}
+}
+
+func TestIgnorePreset(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=8080", "HOST=env", "NAME=env"})
+	for _, ignore := range []bool{false, true} {
+		set := flag.NewFlagSet("preset", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		port := set.Int("port", 0, "")
+		host := set.String("host", "", "")
+		name := set.String("name", "", "")
+		user := set.String("user", "", "")
+		for _, kv := range [][2]string{{"port", "1"}, {"host", "preset"}, {"user", "preset"}} {
+			set.Set(kv[0], kv[1])
+		}
+		opts := []Option{FlagSet(set), Args([]string{"-host=arg"})}
+		if ignore {
+			opts = append(opts, IgnorePreset())
+		}
+		res, err := ParseWithResult(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		wantPort, wantSource := 1, SourceArg
+		if ignore {
+			wantPort, wantSource = 8080, SourceEnv
+		}
+		if *port != wantPort || *host != "arg" || *name != "env" || *user != "preset" {
+			t.Errorf("ignore=%v: unexpected values: port=%d host=%q name=%q user=%q", ignore, *port, *host, *name, *user)
+		}
+		if got := res.Sources["port"]; got != wantSource {
+			t.Errorf("ignore=%v: source: want: %v; got: %v", ignore, wantSource, got)
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"OLD=x", "TOKEN=secret", "PORT=80", "A={{a}}", "B={{b}}"})
+	set := flag.NewFlagSet("logger", flag.ContinueOnError)
+	var out, logs bytes.Buffer
+	set.SetOutput(&out)
+	set.String("new", "", "")
+	set.String("token", "", "")
+	set.Int("port", 0, "")
+	set.String("a", "", "")
+	set.String("b", "", "")
+	set.String("name", "", "")
+	err := Parse(FlagSet(set), Args([]string{"-port=8080"}), KeyChain("new", "new", "/OLD"), Deprecate("OLD", "use NEW"),
+		Defaults(map[string]string{"name": "x"}), WarnPlaceholders(), WarnLimit(1), WithLogger(StdLogger(log.New(&logs, "", 0))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "envflag: warning: flag -a: A has unrendered placeholder: \"{{a}}\"\n" +
+		"envflag: flag -a: set from env A\n" +
+		"envflag: flag -b: set from env B\n" +
+		"envflag: flag -name: set from defaults\n" +
+		"envflag: flag -new: set from env OLD\n" +
+		"envflag: flag -token: set from env TOKEN\n" +
+		"envflag: warning: ...and 2 more warnings\n"
+	if logs.String() != want {
+		t.Errorf("logs: want:\n%s\ngot:\n%s", want, logs.String())
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestFlagInterpolation(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{
+		"LISTEN_ADDR=${host}:${port}", "HOST=${domain}", "URL=http://${listen-addr}/${path}",
+		"PATH=${HOME}/x", "HOME=/root", "DOMAIN=example.com",
+	})
+	set := flag.NewFlagSet("interpolation", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	addr := set.String("listen-addr", "", "")
+	set.String("host", "", "")
+	set.String("domain", "", "")
+	set.Int("port", 80, "")
+	url := set.String("url", "", "")
+	path := set.String("path", "", "")
+	err := Parse(FlagSet(set), Args([]string{"-port=8080"}), FlagInterpolation(), ExpandValues(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *addr != "example.com:8080" || *url != "http://example.com:8080//root/x" || *path != "/root/x" {
+		t.Errorf("unexpected values: listen-addr=%q url=%q path=%q", *addr, *url, *path)
+	}
+
+	setEnv([]string{"A=${b}", "B=x${c}", "C=${a}", "D=${a}", "E=${e}"})
+	set = flag.NewFlagSet("interpolation", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		set.String(name, "", "")
+	}
+	err = Parse(FlagSet(set), Args(nil), FlagInterpolation(), AllErrors())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		"envflag: flag -c: interpolation cycle: -a -> -b -> -c -> -a",
+		"envflag: flag -b: references invalid flag -c",
+		"envflag: flag -a: references invalid flag -b",
+		"envflag: flag -d: references invalid flag -a",
+		"envflag: flag -e: interpolation cycle: -e -> -e",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error: want: %q; got: %q", want, err)
+		}
+	}
+}
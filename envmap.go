@@ -0,0 +1,85 @@
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// A StringMap is a flag.Value holding a map of strings. Each call to its Set
+// method adds an entry given in the form "key=value".
+type StringMap map[string]string
+
+// StringMapVar defines a StringMap flag with the specified name and usage
+// string in set and returns it.
+func StringMapVar(set *flag.FlagSet, name, usage string) *StringMap {
+	m := make(StringMap)
+	set.Var(&m, name, usage)
+	return &m
+}
+
+// Set adds an entry given in the form "key=value".
+func (m *StringMap) Set(entry string) error {
+	k, v, ok := strings.Cut(entry, "=")
+	if !ok {
+		return fmt.Errorf("missing '=' in map entry %q", entry)
+	}
+	if *m == nil {
+		*m = make(StringMap)
+	}
+	(*m)[k] = v
+	return nil
+}
+
+// String returns the entries of the map in the form "key=value",
+// sorted by key and separated by commas.
+func (m *StringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	entries := make([]string, 0, len(*m))
+	for _, k := range sortedKeys(*m) {
+		entries = append(entries, k+"="+(*m)[k])
+	}
+	return strings.Join(entries, ",")
+}
+
+// Get returns the map.
+func (m *StringMap) Get() interface{} {
+	return map[string]string(*m)
+}
+
+// EnvMap returns an Option which, unless the named flag is set by the
+// argument list, sets it from every environment variable whose key starts
+// with prefix, rather than from a single variable. For each such variable,
+// the flag's Set method is called with an entry of the form "key=value",
+// where the key has prefix stripped, so the flag should have a map value,
+// such as a StringMap. The prefix is used verbatim, without the prefix given
+// by Prefix. This captures a dynamic set of variables, such as those to be
+// forwarded to a subprocess.
+//
+// Variables are collected regardless of whether they are also read by other
+// flags. For example, with EnvMap("env", "APP_") and Prefix("APP_"), the
+// variable APP_PORT sets the flag -port and also adds the entry "PORT" to
+// the flag -env. To avoid such overlap, use a distinct prefix for the map.
+func EnvMap(name, prefix string) Option {
+	return func(o *option) {
+		if o.envMaps == nil {
+			o.envMaps = make(map[string]string)
+		}
+		o.envMaps[name] = prefix
+	}
+}
+
+// envMapEntries returns the entries for the named EnvMap flag, sorted by key.
+func (o *option) envMapEntries(name string) []string {
+	prefix := o.envMaps[name]
+	env := o.environ()
+	var entries []string
+	for _, key := range sortedKeys(env) {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			entries = append(entries, key[len(prefix):]+"="+env[key])
+		}
+	}
+	return entries
+}
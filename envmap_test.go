@@ -0,0 +1,39 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestEnvMap(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"FWD_HOME=/home/app", "FWD_LANG=C=UTF-8", "FWD_=x", "APP_PORT=80", "OTHER=y"})
+	set := flag.NewFlagSet("env_map", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	fwd := StringMapVar(set, "fwd", "")
+	all := StringMapVar(set, "app", "")
+	arg := StringMapVar(set, "arg", "")
+	port := set.Int("port", 0, "")
+	err := Parse(FlagSet(set), Args([]string{"-arg=K=V"}), Prefix("APP_"),
+		EnvMap("fwd", "FWD_"), EnvMap("app", "APP_"), EnvMap("arg", "FWD_"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (StringMap{"HOME": "/home/app", "LANG": "C=UTF-8"}); !reflect.DeepEqual(*fwd, want) {
+		t.Errorf("fwd: want: %v; got: %v", want, *fwd)
+	}
+	if want := (StringMap{"PORT": "80"}); !reflect.DeepEqual(*all, want) {
+		t.Errorf("app: want: %v; got: %v", want, *all)
+	}
+	if want := (StringMap{"K": "V"}); !reflect.DeepEqual(*arg, want) {
+		t.Errorf("arg: want: %v; got: %v", want, *arg)
+	}
+	if *port != 80 {
+		t.Errorf("port: want: 80; got: %d", *port)
+	}
+	if got, want := fwd.String(), "HOME=/home/app,LANG=C=UTF-8"; got != want {
+		t.Errorf("string: want: %q; got: %q", want, got)
+	}
+}
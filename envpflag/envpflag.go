@@ -0,0 +1,75 @@
+// Package envpflag adapts envflag to FlagSets of the github.com/spf13/pflag
+// package, so that they are resolved from the environment with the same logic
+// and options as those of the standard flag package.
+package envpflag
+
+import (
+	"flag"
+
+	"github.com/abursavich/envflag"
+	"github.com/spf13/pflag"
+)
+
+// Parse parses flag definitions from the argument list, which should not
+// include the command name, with set and then resolves flags left unset
+// from the environment, as envflag.Parse does with the given options. The
+// FlagSet and Args options are ignored.
+//
+// Flags are named by their long names, so the shorthand of a flag has no
+// environment variable of its own. Flags set from the environment are marked
+// as changed in set. Flags with bool values, as reported by their Type method,
+// accept the same synonyms, such as "yes" and "no", as bool flags do in
+// envflag.
+func Parse(set *pflag.FlagSet, args []string, options ...envflag.Option) error {
+	proxy := flag.NewFlagSet(set.Name(), flag.ContinueOnError)
+	proxy.SetOutput(set.Output())
+	proxy.Usage = func() {
+		if set.Usage != nil {
+			set.Usage()
+		}
+	}
+	values := make(map[string]*value)
+	set.VisitAll(func(f *pflag.Flag) {
+		v := &value{set: set, flag: f}
+		values[f.Name] = v
+		proxy.Var(v, f.Name, f.Usage)
+	})
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	// Mark the flags set by the argument list as set in the proxy,
+	// without setting them again.
+	set.Visit(func(f *pflag.Flag) {
+		v := values[f.Name]
+		v.mute = true
+		proxy.Set(f.Name, f.Value.String())
+		v.mute = false
+	})
+	options = append(options[:len(options):len(options)], envflag.FlagSet(proxy), envflag.Args(nil))
+	return envflag.Parse(options...)
+}
+
+// value is a flag.Value which sets a pflag.Flag.
+type value struct {
+	set  *pflag.FlagSet
+	flag *pflag.Flag
+	mute bool
+}
+
+func (v *value) Set(s string) error {
+	if v.mute {
+		return nil
+	}
+	return v.set.Set(v.flag.Name, s)
+}
+
+func (v *value) String() string {
+	if v == nil || v.flag == nil {
+		return ""
+	}
+	return v.flag.Value.String()
+}
+
+func (v *value) IsBoolFlag() bool {
+	return v.flag.Value.Type() == "bool"
+}
@@ -0,0 +1,55 @@
+package envpflag
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/abursavich/envflag"
+	"github.com/spf13/pflag"
+)
+
+func TestParse(t *testing.T) {
+	for k, v := range map[string]string{
+		"APP_LOG_LEVEL": "debug",
+		"APP_VERBOSE":   "yes",
+		"APP_PORT":      "8080",
+		"APP_TAGS":      "a,b",
+		"APP_NAME":      "env",
+	} {
+		t.Setenv(k, v)
+	}
+	set := pflag.NewFlagSet("pflag", pflag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	level := set.String("log-level", "info", "")
+	verbose := set.BoolP("verbose", "v", false, "")
+	port := set.Int("port", 80, "")
+	tags := set.StringSlice("tags", nil, "")
+	name := set.StringP("name", "n", "", "")
+	err := Parse(set, []string{"-n", "arg", "pos"}, envflag.Prefix("APP_"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *level != "debug" || !*verbose || *port != 8080 || *name != "arg" {
+		t.Errorf("unexpected values: log-level=%q verbose=%v port=%d name=%q", *level, *verbose, *port, *name)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(*tags, want) {
+		t.Errorf("tags: want: %q; got: %q", want, *tags)
+	}
+	for _, name := range []string{"log-level", "verbose", "port", "tags", "name"} {
+		if !set.Changed(name) {
+			t.Errorf("%s: not marked as changed", name)
+		}
+	}
+	if want := []string{"pos"}; !reflect.DeepEqual(set.Args(), want) {
+		t.Errorf("args: want: %q; got: %q", want, set.Args())
+	}
+
+	t.Setenv("APP_PORT", "x")
+	set = pflag.NewFlagSet("pflag", pflag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("port", 80, "")
+	if err := Parse(set, nil, envflag.Prefix("APP_")); err == nil {
+		t.Error("expected error")
+	}
+}
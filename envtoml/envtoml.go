@@ -0,0 +1,435 @@
+// Package envtoml adapts TOML configuration files as a source of flag values
+// for envflag, so that envflag itself has no TOML decoder.
+package envtoml
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/abursavich/envflag"
+)
+
+// File returns an Option which loads values for flags from a TOML file at
+// path, such as an existing configuration file, as envflag.ConfigFile does.
+// Tables and dotted keys map to dotted flag names, so that
+//
+//	verbose = true
+//
+//	[server]
+//	port = 8080
+//	timeout = "5s"
+//
+// sets the flags "verbose", "server.port", and "server.timeout" to "true",
+// "8080", and "5s". Integers are passed to the flag's Set method in decimal,
+// other numbers and dates as they're written in the file, and each element of
+// an array is passed in turn. Since TOML has no durations, they're given as
+// strings. Arrays of tables aren't supported.
+func File(path string) envflag.Option {
+	return envflag.ConfigFile(path, Decode)
+}
+
+// Decode returns the values of the TOML document b, keyed by dotted names,
+// with those of arrays listed in order. It's the decoder used by File.
+func Decode(b []byte) (map[string][]string, error) {
+	p := &parser{s: string(b), line: 1, values: make(map[string][]string), tables: make(map[string]bool)}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", p.line, err)
+	}
+	return p.values, nil
+}
+
+// A parser decodes the subset of TOML which maps onto flags.
+type parser struct {
+	s      string
+	i      int
+	line   int
+	table  string
+	values map[string][]string
+	tables map[string]bool // names of the tables defined so far
+}
+
+func (p *parser) parse() error {
+	for {
+		p.skipSpace(true)
+		if p.i >= len(p.s) {
+			return nil
+		}
+		if p.s[p.i] == '[' {
+			p.i++
+			if p.peek('[') {
+				return errors.New("arrays of tables are not supported")
+			}
+			p.skipSpace(false)
+			key, err := p.key()
+			if err != nil {
+				return err
+			}
+			p.skipSpace(false)
+			if !p.peek(']') {
+				return errors.New("expected ']' after table name")
+			}
+			p.i++
+			if _, ok := p.values[key]; ok || p.tables[key] {
+				return fmt.Errorf("duplicate table [%s]", key)
+			}
+			p.tables[key] = true
+			p.table = key + "."
+		} else {
+			key, err := p.key()
+			if err != nil {
+				return err
+			}
+			p.skipSpace(false)
+			if !p.peek('=') {
+				return fmt.Errorf("expected '=' after key %s", key)
+			}
+			p.i++
+			p.skipSpace(false)
+			if err := p.value(p.table + key); err != nil {
+				return err
+			}
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// peek reports whether the next character is c.
+func (p *parser) peek(c byte) bool {
+	return p.i < len(p.s) && p.s[p.i] == c
+}
+
+// skipSpace skips whitespace and comments, including line breaks if newlines
+// is true.
+func (p *parser) skipSpace(newlines bool) {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t':
+			p.i++
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		case newlines && c == '\n':
+			p.i++
+			p.line++
+		case newlines && c == '\r' && strings.HasPrefix(p.s[p.i:], "\r\n"):
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// endLine consumes the rest of the line, which must be blank or a comment.
+func (p *parser) endLine() error {
+	p.skipSpace(false)
+	if strings.HasPrefix(p.s[p.i:], "\r\n") {
+		p.i++
+	}
+	if p.i < len(p.s) && p.s[p.i] != '\n' {
+		return fmt.Errorf("unexpected %q", p.s[p.i])
+	}
+	return nil
+}
+
+// key returns a key, joining the parts of a dotted key with ".".
+func (p *parser) key() (string, error) {
+	var parts []string
+	for {
+		var part string
+		switch {
+		case p.peek('"'):
+			s, err := p.basicString()
+			if err != nil {
+				return "", err
+			}
+			part = s
+		case p.peek('\''):
+			s, err := p.literalString()
+			if err != nil {
+				return "", err
+			}
+			part = s
+		default:
+			start := p.i
+			for p.i < len(p.s) && isBareKey(p.s[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return "", errors.New("missing key")
+			}
+			part = p.s[start:p.i]
+		}
+		parts = append(parts, part)
+		p.skipSpace(false)
+		if !p.peek('.') {
+			return strings.Join(parts, "."), nil
+		}
+		p.i++
+		p.skipSpace(false)
+	}
+}
+
+func isBareKey(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value adds the value for the named key to the parsed values.
+func (p *parser) value(name string) error {
+	if _, ok := p.values[name]; ok || p.tables[name] {
+		return fmt.Errorf("duplicate key %s", name)
+	}
+	switch {
+	case p.peek('['):
+		p.i++
+		elems := []string{}
+		for {
+			p.skipSpace(true)
+			if p.peek(']') {
+				p.i++
+				break
+			}
+			if p.peek('[') || p.peek('{') {
+				return fmt.Errorf("%s: array elements must be strings, numbers, bools, or dates", name)
+			}
+			s, err := p.scalar()
+			if err != nil {
+				return err
+			}
+			elems = append(elems, s)
+			p.skipSpace(true)
+			if p.peek(',') {
+				p.i++
+			} else if !p.peek(']') {
+				return fmt.Errorf("%s: expected ',' or ']' in array", name)
+			}
+		}
+		p.values[name] = elems
+	case p.peek('{'):
+		p.i++
+		p.tables[name] = true
+		p.skipSpace(false)
+		if p.peek('}') {
+			p.i++
+			return nil
+		}
+		for {
+			key, err := p.key()
+			if err != nil {
+				return err
+			}
+			p.skipSpace(false)
+			if !p.peek('=') {
+				return fmt.Errorf("expected '=' after key %s", key)
+			}
+			p.i++
+			p.skipSpace(false)
+			if err := p.value(name + "." + key); err != nil {
+				return err
+			}
+			p.skipSpace(false)
+			if p.peek('}') {
+				p.i++
+				return nil
+			}
+			if !p.peek(',') {
+				return fmt.Errorf("%s: expected ',' or '}' in inline table", name)
+			}
+			p.i++
+			p.skipSpace(false)
+		}
+	default:
+		s, err := p.scalar()
+		if err != nil {
+			return err
+		}
+		p.values[name] = []string{s}
+	}
+	return nil
+}
+
+// scalar returns the string form of a string, number, bool, or date.
+func (p *parser) scalar() (string, error) {
+	switch {
+	case strings.HasPrefix(p.s[p.i:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.s[p.i:], `'''`):
+		return p.multilineString(`'''`)
+	case p.peek('"'):
+		return p.basicString()
+	case p.peek('\''):
+		return p.literalString()
+	}
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(" \t\r\n,]}#", rune(p.s[p.i])) {
+		p.i++
+	}
+	tok := p.s[start:p.i]
+	// A date may be separated from a time by a space.
+	if len(tok) == 10 && tok[4] == '-' && p.i+1 < len(p.s) && p.s[p.i] == ' ' && p.s[p.i+1] >= '0' && p.s[p.i+1] <= '9' {
+		p.i++
+		for p.i < len(p.s) && !strings.ContainsRune(" \t\r\n,]}#", rune(p.s[p.i])) {
+			p.i++
+		}
+		tok = p.s[start:p.i]
+	}
+	if tok == "" {
+		return "", errors.New("missing value")
+	}
+	return scalarString(tok)
+}
+
+// scalarString returns the string form of an unquoted value.
+func scalarString(tok string) (string, error) {
+	if tok == "true" || tok == "false" {
+		return tok, nil
+	}
+	if len(tok) >= 10 && tok[4] == '-' && tok[7] == '-' || len(tok) >= 8 && tok[2] == ':' {
+		return tok, nil
+	}
+	digits := strings.TrimLeft(tok, "+-")
+	if len(tok) > 1 && tok[0] == '0' && (tok[1] == 'x' || tok[1] == 'o' || tok[1] == 'b') {
+		if n, err := strconv.ParseUint(tok, 0, 64); err == nil {
+			return strconv.FormatUint(n, 10), nil
+		}
+	} else if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return "", fmt.Errorf("invalid value %q", tok)
+	} else if n, err := strconv.ParseInt(strings.ReplaceAll(tok, "_", ""), 10, 64); err == nil {
+		return strconv.FormatInt(n, 10), nil
+	} else if _, err := strconv.ParseFloat(strings.ReplaceAll(tok, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(tok, "_", ""), nil
+	}
+	return "", fmt.Errorf("invalid value %q", tok)
+}
+
+// literalString returns a single-line string in single quotes.
+func (p *parser) literalString() (string, error) {
+	end := strings.IndexAny(p.s[p.i+1:], "'\n")
+	if end < 0 || p.s[p.i+1+end] != '\'' {
+		return "", errors.New("unterminated string")
+	}
+	s := p.s[p.i+1 : p.i+1+end]
+	p.i += end + 2
+	return s, nil
+}
+
+// basicString returns a single-line string in double quotes, with its escapes
+// replaced.
+func (p *parser) basicString() (string, error) {
+	var b strings.Builder
+	for p.i++; p.i < len(p.s); {
+		switch c := p.s[p.i]; c {
+		case '"':
+			p.i++
+			return b.String(), nil
+		case '\n':
+			return "", errors.New("unterminated string")
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// multilineString returns a string delimited by quote, which is three double
+// or single quotes, trimmed of a line break following the opening delimiter.
+func (p *parser) multilineString(quote string) (string, error) {
+	p.i += len(quote)
+	if strings.HasPrefix(p.s[p.i:], "\r\n") {
+		p.i++
+	}
+	if p.peek('\n') {
+		p.i++
+		p.line++
+	}
+	var b strings.Builder
+	for p.i < len(p.s) {
+		if strings.HasPrefix(p.s[p.i:], quote) {
+			p.i += len(quote)
+			// Up to two quotes may directly precede the closing delimiter.
+			for n := 0; n < 2 && p.peek(quote[0]); n++ {
+				b.WriteByte(quote[0])
+				p.i++
+			}
+			return b.String(), nil
+		}
+		switch c := p.s[p.i]; {
+		case c == '\\' && quote == `"""`:
+			// A backslash ending a line trims the line break and any
+			// whitespace which follows it.
+			if rest := strings.TrimLeft(p.s[p.i+1:], " \t\r"); strings.HasPrefix(rest, "\n") {
+				p.i = len(p.s) - len(rest)
+				for p.i < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.i])) {
+					if p.s[p.i] == '\n' {
+						p.line++
+					}
+					p.i++
+				}
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		case c == '\r' && strings.HasPrefix(p.s[p.i:], "\r\n"):
+			p.i++
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// escape writes the character represented by the escape sequence at the
+// current position to b.
+func (p *parser) escape(b *strings.Builder) error {
+	if p.i+1 >= len(p.s) {
+		return errors.New("unterminated string")
+	}
+	c := p.s[p.i+1]
+	p.i += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.i+n > len(p.s) {
+			return fmt.Errorf("invalid escape \\%c", c)
+		}
+		r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid escape \\%c%s", c, p.s[p.i:p.i+n])
+		}
+		b.WriteRune(rune(r))
+		p.i += n
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package envtoml
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abursavich/envflag"
+)
+
+// stringList is a flag value which accumulates the values passed to Set.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+func TestFile(t *testing.T) {
+	t.Setenv("APP_SERVER_HOST", "env")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	config := `# comment
+verbose = true
+ratio = 1_500.5
+"quoted.key" = 'literal \n'
+
+[server]
+host = "toml"
+port = 8_080 # comment
+timeout = "5s"
+mode = 0x10
+tags = [
+	"a", # first
+	2,
+	false,
+]
+log = { level = "debug", format.kind = """
+multi\
+    line""" }
+
+[ server . tls ]
+cert = '''
+C:\path'''
+`
+	if err := os.WriteFile(path, []byte(strings.ReplaceAll(config, "\n", "\r\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("toml", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	verbose := set.Bool("verbose", false, "")
+	ratio := set.Float64("ratio", 0, "")
+	quoted := set.String("quoted.key", "", "")
+	host := set.String("server.host", "", "")
+	port := set.Int("server.port", 0, "")
+	timeout := set.Duration("server.timeout", 0, "")
+	mode := set.Int("server.mode", 0, "")
+	level := set.String("server.log.level", "info", "")
+	kind := set.String("server.log.format.kind", "", "")
+	cert := set.String("server.tls.cert", "", "")
+	name := set.String("name", "default", "")
+	var tags stringList
+	set.Var(&tags, "server.tags", "")
+	res, err := envflag.ParseWithResult(envflag.FlagSet(set), envflag.Prefix("APP"), envflag.Args([]string{"-server.port=9090"}),
+		File(filepath.Join(dir, "missing.toml")), File(path))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*verbose || *ratio != 1500.5 || *quoted != `literal \n` || *host != "env" || *port != 9090 || *timeout != 5*time.Second ||
+		*mode != 16 || *level != "debug" || *kind != "multiline" || *cert != `C:\path` || *name != "default" {
+		t.Errorf("unexpected values: verbose=%v ratio=%v quoted=%q host=%q port=%d timeout=%v mode=%d level=%q kind=%q cert=%q name=%q",
+			*verbose, *ratio, *quoted, *host, *port, *timeout, *mode, *level, *kind, *cert, *name)
+	}
+	if want := (stringList{"a", "2", "false"}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags: want: %q; got: %q", want, tags)
+	}
+	if got := res.Sources["server.timeout"]; got != envflag.SourceConfig {
+		t.Errorf("source: want: %v; got: %v", envflag.SourceConfig, got)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"port = ", "line 1: missing value"},
+		{"port = 1\nport = 2", "line 2: duplicate key port"},
+		{"[server]\nport = 1\n[server]\nname = \"x\"", "line 3: duplicate table [server]"},
+		{"server = {port = 1}\n[server]", "line 2: duplicate table [server]"},
+		{"[server]\n[other]\nserver = {}\nserver = {}", "line 4: duplicate key other.server"},
+		{"port = 1\n[port]", "line 2: duplicate table [port]"},
+		{"[[servers]]", "arrays of tables are not supported"},
+		{"port = 1 2", `line 1: unexpected '2'`},
+		{"port = 007", `invalid value "007"`},
+		{`name = "open`, "unterminated string"},
+		{"tags = [[1]]", "tags: array elements must be strings, numbers, bools, or dates"},
+		{`port = "x"`, `invalid value "x" for flag -port`},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		set := flag.NewFlagSet("toml", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.Int("port", 0, "")
+		set.String("name", "", "")
+		set.Var(&stringList{}, "tags", "")
+		err := envflag.Parse(envflag.FlagSet(set), envflag.Args(nil), File(path))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error: want: %q; got: %v", tt.config, tt.want, err)
+		}
+	}
+}
+
+func TestDecodeDates(t *testing.T) {
+	got, err := Decode([]byte("a = 1979-05-27T07:32:00Z\nb = 1979-05-27 07:32:00\nc = 07:32:00\nd = -inf\ne = +1_000\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{
+		"a": {"1979-05-27T07:32:00Z"},
+		"b": {"1979-05-27 07:32:00"},
+		"c": {"07:32:00"},
+		"d": {"-inf"},
+		"e": {"1000"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
@@ -0,0 +1,105 @@
+package envflag
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileAllowed returns an Option which allows the named flags, typically those
+// holding secrets, to be read from files. If a flag's environment variable,
+// such as DB_PASSWORD, is not set but the same key with the suffix "_FILE",
+// such as DB_PASSWORD_FILE, is, the flag is set to the contents of the file
+// at the path given by the latter, with a single trailing newline removed.
+// This is the convention used for secrets mounted into containers. The suffix
+// is joined to the key by the Separator, and is lower-case with PreserveCase
+// if the key is, so with Separator(".") and PreserveCase the key db.password
+// has the file key db.password.file.
+//
+// Flags which are not named ignore any "_FILE" variables, so that a stray
+// variable cannot cause arbitrary files to be read into flags which are not
+// expected to hold their contents, which may then be logged or reported.
+func FileAllowed(names ...string) Option {
+	return func(o *option) {
+		if o.fileAllowed == nil {
+			o.fileAllowed = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.fileAllowed[name] = true
+		}
+	}
+}
+
+// FileIndirection returns an Option which allows every flag to be read from
+// a file, as described for FileAllowed. If FileAllowed is also given, only
+// the flags it names are allowed, so that FileIndirection cannot widen its
+// restriction. Prefer FileAllowed for flags holding secrets.
+func FileIndirection() Option {
+	return func(o *option) {
+		o.fileAll = true
+	}
+}
+
+// fileKey returns the key of the environment variable giving the path of a
+// file containing the value of key.
+func (o *option) fileKey(key string) string {
+	sep, suffix := "_", "FILE"
+	if o.separator != nil && !o.exactCase {
+		sep = *o.separator
+	}
+	if o.preserveCase && key == strings.ToLower(key) {
+		suffix = "file"
+	}
+	return key + sep + suffix
+}
+
+// readFileKey reads the value of the named flag from the file given by the
+// environment variable fileKey(key), if it is allowed and set.
+func (o *option) readFileKey(name, key string) (string, string, bool, error) {
+	if !o.fileOK(name) {
+		return "", "", false, nil
+	}
+	key = o.fileKey(key)
+	path, ok := o.lookupKey(key)
+	if !o.defined(name, path, ok) {
+		return "", key, false, nil
+	}
+	b, err := o.readFile(path)
+	if err != nil {
+		return "", key, true, fmt.Errorf("envflag: flag -%s: %s: %w", name, key, err)
+	}
+	v := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(v, "\r"), key, true, nil
+}
+
+// fileOK reports whether the named flag may be read from a file.
+func (o *option) fileOK(name string) bool {
+	return o.fileAll && o.fileAllowed == nil || o.fileAllowed[name]
+}
+
+// readFile reads the file at path, returning early with the context's error if
+// it's done first, so that a hung mount cannot block parsing indefinitely.
+func (o *option) readFile(path string) ([]byte, error) {
+	done := o.ctx.Done()
+	if done == nil {
+		return os.ReadFile(path)
+	}
+	if err := o.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	type result struct {
+		b   []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		b, err := os.ReadFile(path)
+		ch <- result{b, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.b, r.err
+	case <-done:
+		return nil, fmt.Errorf("read %s: %w", path, o.ctx.Err())
+	}
+}
@@ -0,0 +1,145 @@
+package envflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileAllowed(t *testing.T) {
+	defer resetEnv()()
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("hunter2\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv([]string{
+		"PASSWORD_FILE=" + secret,
+		"TOKEN=direct",
+		"TOKEN_FILE=" + secret,
+		"NAME_FILE=" + secret,
+	})
+	set := flag.NewFlagSet("file_allowed", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	password := set.String("password", "", "")
+	token := set.String("token", "", "")
+	name := set.String("name", "default", "")
+	if err := Parse(FlagSet(set), Args(nil), FileAllowed("password", "token")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *password != "hunter2" {
+		t.Errorf("password: want: %q; got: %q", "hunter2", *password)
+	}
+	if *token != "direct" {
+		t.Errorf("token: want: %q; got: %q", "direct", *token)
+	}
+	if *name != "default" {
+		t.Errorf("name: not allowed: want: %q; got: %q", "default", *name)
+	}
+
+	setEnv([]string{"PASSWORD_FILE=" + filepath.Join(dir, "missing")})
+	set = flag.NewFlagSet("file_allowed", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("password", "", "")
+	err := Parse(FlagSet(set), Args(nil), FileAllowed("password"))
+	if err == nil || !strings.Contains(err.Error(), "envflag: flag -password: PASSWORD_FILE:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	defer resetEnv()()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		opts []Option
+	}{
+		{"DB_PASSWORD_FILE", nil},
+		{"DB.PASSWORD.FILE", []Option{Separator(".")}},
+		{"DBPASSWORDFILE", []Option{Separator("")}},
+		{"db_password_file", []Option{PreserveCase()}},
+		{"db.password.file", []Option{Separator("."), PreserveCase()}},
+		{"App.db.password.FILE", []Option{Separator("."), PreserveCase(), Prefix("App")}},
+		{"db.password_FILE", []Option{ExactCase(), Separator(".")}},
+	}
+	for _, tt := range tests {
+		setEnv([]string{tt.key + "=" + path})
+		set := flag.NewFlagSet("file_key", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		password := set.String("db.password", "", "")
+		opts := append([]Option{FlagSet(set), Args(nil), FileAllowed("db.password")}, tt.opts...)
+		if err := Parse(opts...); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.key, err)
+		}
+		if *password != "hunter2" {
+			t.Errorf("%s: want: %q; got: %q", tt.key, "hunter2", *password)
+		}
+	}
+}
+
+func TestFileIndirection(t *testing.T) {
+	defer resetEnv()()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("abc\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv([]string{"API_TOKEN_FILE=" + path, "NAME_FILE=" + path, "DIRECT=x", "DIRECT_FILE=" + path})
+	for _, tt := range []struct {
+		opts []Option
+		want map[string]string
+	}{
+		{
+			opts: []Option{FileIndirection()},
+			want: map[string]string{"api_token": "abc\n", "name": "abc\n", "direct": "x"},
+		},
+		{
+			opts: []Option{FileIndirection(), FileAllowed("api_token")},
+			want: map[string]string{"api_token": "abc\n", "name": "", "direct": "x"},
+		},
+	} {
+		set := flag.NewFlagSet("file_indirection", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.String("api_token", "", "")
+		set.String("name", "", "")
+		set.String("direct", "", "")
+		if err := Parse(append(tt.opts, FlagSet(set), Args(nil))...); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := make(map[string]string)
+		set.VisitAll(func(f *flag.Flag) { got[f.Name] = f.Value.String() })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("want: %q; got: %q", tt.want, got)
+		}
+	}
+}
+
+func TestParseContextFiles(t *testing.T) {
+	defer resetEnv()()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv([]string{"TOKEN_FILE=" + path})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, opt := range []Option{FileAllowed("token"), EnvFile(path)} {
+		set := flag.NewFlagSet("context", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.String("token", "", "")
+		if err := ParseContext(ctx, FlagSet(set), Args(nil), opt); !errors.Is(err, context.Canceled) {
+			t.Errorf("want: %v; got: %v", context.Canceled, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package envflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// JSONFile returns an Option which loads values for flags from a JSON file
+// holding an object which maps flag names to values, such as an existing
+// configuration file. Its values are used only if neither the argument list
+// nor the environment has a value for a flag, but before the flag's default
+// value. The properties of a nested object map to dotted flag names, so that
+//
+//	{"log": {"level": "debug"}, "port": 8080, "verbose": true}
+//
+// sets the flags "log.level", "port", and "verbose" to "debug", "8080", and
+// "true". Numbers are passed to the flag's Set method as they're written in
+// the file, each element of an array is passed in turn, as for SplitValues,
+// and null is ignored. Properties which don't name a defined flag are ignored.
+// If the file does not exist, the option has no effect; if it cannot be
+// decoded, Parse fails. The values of a later file replace those of an
+// earlier one.
+func JSONFile(path string) Option {
+	return func(o *option) {
+		o.jsonFiles = append(o.jsonFiles, path)
+	}
+}
+
+func (o *option) loadJSONFiles() error {
+	for _, path := range o.jsonFiles {
+		b, err := o.readFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("envflag: %w", err)
+		}
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		var obj map[string]interface{}
+		if err := d.Decode(&obj); err != nil {
+			return fmt.Errorf("envflag: %s: %v", path, err)
+		}
+		if d.More() {
+			return fmt.Errorf("envflag: %s: unexpected data after top-level object", path)
+		}
+		if o.jsonValues == nil {
+			o.jsonValues = make(map[string][]string)
+		}
+		if err := flattenJSON(o.jsonValues, "", obj); err != nil {
+			return fmt.Errorf("envflag: %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// flattenJSON adds the values of obj to values, keyed by dotted names
+// beginning with prefix.
+func flattenJSON(values map[string][]string, prefix string, obj map[string]interface{}) error {
+	for _, key := range sortedKeys(obj) {
+		name := prefix + key
+		switch v := obj[key].(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flattenJSON(values, name+".", v); err != nil {
+				return err
+			}
+		case []interface{}:
+			elems := make([]string, 0, len(v))
+			for _, e := range v {
+				s, ok := jsonScalar(e)
+				if !ok {
+					return fmt.Errorf("%s: array elements must be strings, numbers, or bools", name)
+				}
+				elems = append(elems, s)
+			}
+			values[name] = elems
+		default:
+			s, _ := jsonScalar(v)
+			values[name] = []string{s}
+		}
+	}
+	return nil
+}
+
+// jsonScalar returns the string form of a decoded string, number, or bool.
+func jsonScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		if v {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+// jsonValue returns the value for the named flag from files given to JSONFile.
+func (o *option) jsonValue(name string) (string, bool) {
+	values, ok := o.jsonValues[name]
+	return strings.Join(values, ","), ok
+}
@@ -0,0 +1,106 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONFile(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_HOST=env"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	config := `{
+		"host": "json",
+		"port": 8080,
+		"ratio": 1.5e2,
+		"verbose": true,
+		"log": {"level": "debug", "format": null},
+		"tags": ["a", 2, false],
+		"unknown": "ignored"
+	}`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("json", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	host := set.String("host", "", "")
+	port := set.Int("port", 0, "")
+	ratio := set.Float64("ratio", 0, "")
+	verbose := set.Bool("verbose", false, "")
+	level := set.String("log.level", "info", "")
+	format := set.String("log.format", "text", "")
+	name := set.String("name", "default", "")
+	var tags stringList
+	set.Var(&tags, "tags", "")
+	res, err := ParseWithResult(FlagSet(set), Prefix("APP_"), Args([]string{"-port=9090"}),
+		JSONFile(filepath.Join(dir, "missing.json")), JSONFile(path))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *host != "env" || *port != 9090 || *ratio != 150 || !*verbose || *level != "debug" || *format != "text" || *name != "default" {
+		t.Errorf("unexpected values: host=%q port=%d ratio=%v verbose=%v level=%q format=%q name=%q",
+			*host, *port, *ratio, *verbose, *level, *format, *name)
+	}
+	if want := (stringList{"a", "2", "false"}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags: want: %q; got: %q", want, tags)
+	}
+	if got := res.Sources["log.level"]; got != SourceJSON {
+		t.Errorf("source: want: %v; got: %v", SourceJSON, got)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{"port": `, "unexpected EOF"},
+		{`["port"]`, "cannot unmarshal array"},
+		{`{"port": 1} {}`, "unexpected data after top-level object"},
+		{`{"tags": [{}]}`, "tags: array elements must be strings, numbers, or bools"},
+		{`{"port": "x"}`, `invalid value "x" for flag -port`},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		set := flag.NewFlagSet("json", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.Int("port", 0, "")
+		set.Var(&stringList{}, "tags", "")
+		err := Parse(FlagSet(set), Args(nil), JSONFile(path))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error: want: %q; got: %v", tt.config, tt.want, err)
+		}
+	}
+}
+
+func TestJSONFileInterpolation(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=8080"})
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"host": "example.com", "addr": "${host}:${port}", "tags": ["${host}", "b"]}`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("json", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("host", "", "")
+	set.Int("port", 0, "")
+	addr := set.String("addr", "", "")
+	var tags stringList
+	set.Var(&tags, "tags", "")
+	if err := Parse(FlagSet(set), Args(nil), JSONFile(path), FlagInterpolation()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *addr != "example.com:8080" {
+		t.Errorf("addr: want: %q; got: %q", "example.com:8080", *addr)
+	}
+	if want := (stringList{"example.com", "b"}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags: want: %q; got: %q", want, tags)
+	}
+}
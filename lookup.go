@@ -0,0 +1,155 @@
+package envflag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// A LookupFunc looks up the value of a key in a source that may fail, such as
+// a remote configuration service. The boolean result reports whether the key
+// is present. An error reports a failure to look up the key; a missing key is
+// not an error.
+type LookupFunc func(ctx context.Context, key string) (string, bool, error)
+
+// LookupSource returns an Option which specifies a source to consult for
+// environment variable keys that are not present in the environment.
+// It is called with the context given to ParseContext.
+func LookupSource(fn LookupFunc) Option {
+	return func(o *option) {
+		o.source = fn
+	}
+}
+
+// Retry returns an Option which retries failed calls to a LookupSource,
+// making up to the given number of attempts in total. Before the nth retry,
+// Parse waits for a random duration in [d/2, d), where d = backoff * 2^(n-1),
+// so the total wait is less than backoff * (2^(attempts-1) - 1). Retries stop
+// early, returning the last error, if the wait would outlast the deadline of
+// the context given to ParseContext. Missing keys are not retried. Parse fails
+// if attempts is less than 1 or backoff is negative.
+func Retry(attempts int, backoff time.Duration) Option {
+	return func(o *option) {
+		if (attempts < 1 || backoff < 0) && o.err == nil {
+			o.err = fmt.Errorf("envflag: invalid retry: %d attempts with backoff %v", attempts, backoff)
+		}
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
+// StickyCache returns an Option which saves the values read from a
+// LookupSource to a file at path after each successful Parse. If a later
+// lookup fails, the saved value for its key is used instead, provided that
+// it was read less than ttl ago. The cache is only consulted for keys that
+// the LookupSource fails to look up, so it never overrides values from the
+// argument list, the environment, or an available LookupSource. Saved values
+// of keys which aren't looked up by a later Parse are kept until they expire,
+// ttl after they were read. The file is not rewritten by a Parse which used any saved values.
+func StickyCache(path string, ttl time.Duration) Option {
+	return func(o *option) {
+		o.sticky = path
+		o.stickyTTL = ttl
+	}
+}
+
+type stickyCache struct {
+	Values map[string]stickyEntry `json:"values"`
+}
+
+// A stickyEntry is a saved value and the time it was read.
+type stickyEntry struct {
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+func (o *option) lookupSource(key string) (string, bool, error) {
+	v, ok, err := o.retryLookup(key)
+	if err != nil && o.sticky != "" {
+		if v, ok := o.stickyValue(key); ok {
+			o.stale = true
+			return v, true, nil
+		}
+	}
+	if ok && o.sticky != "" {
+		if o.fetched == nil {
+			o.fetched = make(map[string]string)
+		}
+		o.fetched[key] = v
+	}
+	return v, ok, err
+}
+
+func (o *option) retryLookup(key string) (string, bool, error) {
+	delay := o.backoff
+	for attempt := 1; ; attempt++ {
+		v, ok, err := o.source(o.ctx, key)
+		if err == nil {
+			return v, ok, nil
+		}
+		if attempt >= o.attempts {
+			return "", false, fmt.Errorf("envflag: lookup %s: %v", key, err)
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if deadline, ok := o.ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return "", false, fmt.Errorf("envflag: lookup %s: %v", key, err)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-o.ctx.Done():
+			t.Stop()
+			return "", false, fmt.Errorf("envflag: lookup %s: %v", key, o.ctx.Err())
+		case <-t.C:
+		}
+		if delay <= math.MaxInt64/2 {
+			delay *= 2
+		}
+	}
+}
+
+// loadSticky returns the saved values which haven't expired.
+func (o *option) loadSticky() map[string]stickyEntry {
+	if o.stickyCache == nil {
+		o.stickyCache = &stickyCache{}
+		if b, err := o.readFile(o.sticky); err == nil {
+			json.Unmarshal(b, o.stickyCache)
+		}
+		for k, e := range o.stickyCache.Values {
+			if time.Since(e.Time) >= o.stickyTTL {
+				delete(o.stickyCache.Values, k)
+			}
+		}
+	}
+	return o.stickyCache.Values
+}
+
+func (o *option) stickyValue(key string) (string, bool) {
+	e, ok := o.loadSticky()[key]
+	return e.Value, ok
+}
+
+func (o *option) writeSticky() error {
+	// Keep the saved values of keys which weren't looked up this time, such
+	// as those of flags set by the argument list, with the times they were
+	// read, so that they still expire.
+	values := make(map[string]stickyEntry)
+	for k, e := range o.loadSticky() {
+		values[k] = e
+	}
+	now := time.Now()
+	for k, v := range o.fetched {
+		values[k] = stickyEntry{Value: v, Time: now}
+	}
+	b, err := json.Marshal(stickyCache{Values: values})
+	if err == nil {
+		err = os.WriteFile(o.sticky, b, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("envflag: writing sticky cache: %v", err)
+	}
+	return nil
+}
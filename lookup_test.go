@@ -0,0 +1,167 @@
+package envflag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookupSource(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"ENV=from_env"})
+	calls := make(map[string]int)
+	fn := func(ctx context.Context, key string) (string, bool, error) {
+		calls[key]++
+		switch key {
+		case "FLAKY":
+			if calls[key] < 3 {
+				return "", false, errors.New("unavailable")
+			}
+			return "recovered", true, nil
+		case "DOWN":
+			return "", false, errors.New("unavailable")
+		case "ENV", "REMOTE":
+			return "from_lookup", true, nil
+		}
+		return "", false, nil
+	}
+
+	set := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	env := set.String("env", "", "")
+	remote := set.String("remote", "", "")
+	flaky := set.String("flaky", "", "")
+	set.String("missing", "", "")
+	err := ParseContext(context.Background(), FlagSet(set), Args(nil), LookupSource(fn), Retry(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *env != "from_env" || *remote != "from_lookup" || *flaky != "recovered" {
+		t.Errorf("unexpected values: env=%q remote=%q flaky=%q", *env, *remote, *flaky)
+	}
+	if calls["ENV"] != 0 || calls["FLAKY"] != 3 || calls["MISSING"] != 1 {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+
+	set = flag.NewFlagSet("lookup", flag.ContinueOnError)
+	set.String("down", "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = ParseContext(ctx, FlagSet(set), Args(nil), LookupSource(fn), Retry(10, 20*time.Millisecond))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("retries outlasted context deadline: %v", d)
+	}
+}
+
+func TestRetryInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		attempts int
+		backoff  time.Duration
+		want     string
+	}{
+		{0, time.Millisecond, "envflag: invalid retry: 0 attempts with backoff 1ms"},
+		{1, -2, "envflag: invalid retry: 1 attempts with backoff -2ns"},
+	} {
+		set := flag.NewFlagSet("retry", flag.ContinueOnError)
+		set.String("a", "", "")
+		err := Parse(FlagSet(set), Args(nil), Retry(tt.attempts, tt.backoff))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Retry(%d, %v): error: want: %q; got: %v", tt.attempts, tt.backoff, tt.want, err)
+		}
+	}
+}
+
+func TestStickyCache(t *testing.T) {
+	defer resetEnv()()
+	path := filepath.Join(t.TempDir(), "sticky.json")
+	up := true
+	fn := func(ctx context.Context, key string) (string, bool, error) {
+		if !up {
+			return "", false, errors.New("unavailable")
+		}
+		return "from_lookup", true, nil
+	}
+	parse := func(ttl time.Duration, env ...string) (string, string, error) {
+		resetEnv()
+		setEnv(env)
+		set := flag.NewFlagSet("sticky", flag.ContinueOnError)
+		a := set.String("a", "", "")
+		b := set.String("b", "", "")
+		err := Parse(FlagSet(set), Args(nil), LookupSource(fn), StickyCache(path, ttl))
+		return *a, *b, err
+	}
+
+	if a, b, err := parse(time.Hour); err != nil || a != "from_lookup" || b != "from_lookup" {
+		t.Fatalf("up: a=%q b=%q err=%v", a, b, err)
+	}
+	up = false
+	if a, b, err := parse(time.Hour, "B=from_env"); err != nil || a != "from_lookup" || b != "from_env" {
+		t.Fatalf("down: a=%q b=%q err=%v", a, b, err)
+	}
+	if a, b, err := parse(time.Hour); err != nil || a != "from_lookup" || b != "from_lookup" {
+		t.Fatalf("down again: a=%q b=%q err=%v", a, b, err)
+	}
+	if _, _, err := parse(time.Nanosecond); err == nil {
+		t.Fatal("stale: expected error")
+	}
+
+	// Saved values are kept for keys which weren't looked up.
+	up = true
+	if a, b, err := parse(time.Hour, "B=from_env"); err != nil || a != "from_lookup" || b != "from_env" {
+		t.Fatalf("up with env: a=%q b=%q err=%v", a, b, err)
+	}
+	up = false
+	if a, b, err := parse(time.Hour); err != nil || a != "from_lookup" || b != "from_lookup" {
+		t.Fatalf("down without env: a=%q b=%q err=%v", a, b, err)
+	}
+
+	// Saved values which aren't looked up keep the time they were read.
+	read := time.Now().Add(-30 * time.Minute).UTC()
+	write := func(c stickyCache) {
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() stickyCache {
+		var c stickyCache
+		b, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &c)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	write(stickyCache{Values: map[string]stickyEntry{"A": {"old", read}, "C": {"expired", read.Add(-time.Hour)}}})
+	up = true
+	if _, _, err := parse(time.Hour, "A=from_env"); err != nil {
+		t.Fatalf("up with env: %v", err)
+	}
+	c := load()
+	if e := c.Values["A"]; e.Value != "old" || !e.Time.Equal(read) {
+		t.Errorf("carried entry: want: %q at %v; got: %q at %v", "old", read, e.Value, e.Time)
+	}
+	if _, ok := c.Values["C"]; ok {
+		t.Error("expired entry not dropped")
+	}
+	up = false
+	if _, _, err := parse(20 * time.Minute); err == nil {
+		t.Fatal("carried entry past ttl: expected error")
+	}
+	if a, b, err := parse(20*time.Minute, "A=from_env"); err != nil || a != "from_env" || b != "from_lookup" {
+		t.Fatalf("fresh entry: a=%q b=%q err=%v", a, b, err)
+	}
+}
@@ -0,0 +1,67 @@
+package envflag
+
+import (
+	"os"
+	"strings"
+)
+
+// A Lookuper looks up the values of environment variables.
+type Lookuper interface {
+	// Lookup returns the value of the variable named by key and whether it
+	// is present.
+	Lookup(key string) (string, bool)
+}
+
+// Environment returns an Option which specifies the environment from which
+// to read environment variables. If unused, the process environment is read.
+// A Lookuper which doesn't also enumerate its variables, as ProcessEnv and
+// MapEnv do, provides no variables to EnvMap.
+func Environment(l Lookuper) Option {
+	return func(o *option) {
+		o.lookup = l.Lookup
+		o.environ = func() map[string]string { return nil }
+		if e, ok := l.(interface{ environ() map[string]string }); ok {
+			o.environ = e.environ
+		}
+	}
+}
+
+// Env returns an Option which specifies a snapshot of the environment from
+// which to read environment variables, given as "KEY=value" pairs in the form
+// returned by os.Environ, as with Environment and a MapEnv. If a key is given
+// more than once, its last value is used, and pairs without a key are ignored.
+func Env(env []string) Option {
+	m := make(MapEnv, len(env))
+	for _, kv := range env {
+		if i := strings.Index(kv, "="); i > 0 {
+			m[kv[:i]] = kv[i+1:]
+		}
+	}
+	return Environment(m)
+}
+
+// ProcessEnv is a Lookuper which reads the process environment.
+type ProcessEnv struct{}
+
+// Lookup returns the value of the environment variable named by key,
+// as os.LookupEnv does.
+func (ProcessEnv) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (ProcessEnv) environ() map[string]string {
+	return environ()
+}
+
+// MapEnv is a Lookuper which reads variables from a map, such as in tests.
+type MapEnv map[string]string
+
+// Lookup returns the value of the variable named by key in the map.
+func (m MapEnv) Lookup(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m MapEnv) environ() map[string]string {
+	return m
+}
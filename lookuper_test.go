@@ -0,0 +1,51 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_NAME=process"})
+	env := MapEnv{"APP_NAME": "map", "APP_PORT": "8080", "FWD_A": "1"}
+	set := flag.NewFlagSet("environment", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	name := set.String("name", "", "")
+	port := set.Int("port", 0, "")
+	fwd := StringMapVar(set, "fwd", "")
+	err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), Environment(env), EnvMap("fwd", "FWD_"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *name != "map" || *port != 8080 {
+		t.Errorf("unexpected values: name=%q port=%d", *name, *port)
+	}
+	if want := (StringMap{"A": "1"}); !reflect.DeepEqual(*fwd, want) {
+		t.Errorf("fwd: want: %v; got: %v", want, *fwd)
+	}
+	if v, ok := (ProcessEnv{}).Lookup("APP_NAME"); !ok || v != os.Getenv("APP_NAME") {
+		t.Errorf("ProcessEnv: want: %q; got: %q", "process", v)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_NAME=process", "APP_HOST=process"})
+	set := flag.NewFlagSet("env", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	name := set.String("name", "", "")
+	port := set.Int("port", 0, "")
+	host := set.String("host", "default", "")
+	eq := set.String("eq", "", "")
+	env := []string{"APP_NAME=first", "APP_PORT=8080", "=C:=C:\\", "INVALID", "APP_NAME=last", "APP_EQ=a=b"}
+	if err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), Env(env)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *name != "last" || *port != 8080 || *host != "default" || *eq != "a=b" {
+		t.Errorf("unexpected values: name=%q port=%d host=%q eq=%q", *name, *port, *host, *eq)
+	}
+}
@@ -0,0 +1,506 @@
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// AcronymAware returns an Option which separates the words of camel-cased
+// flag names when looking up corresponding environment variables, keeping
+// runs of capitals together as acronyms. For example, "apiKeyID" is looked up
+// as API_KEY_ID, "HTTPServer" as HTTP_SERVER, and "userIDs" as USER_IDS, since
+// a lower-case "s" ending an acronym is taken as its plural. Digits belong to
+// the word they follow, so "oauth2Token" is looked up as OAUTH2_TOKEN.
+func AcronymAware() Option {
+	return func(o *option) {
+		o.acronyms = true
+	}
+}
+
+// PreserveCase returns an Option which preserves the case of flag names and
+// the Prefix when deriving environment variable keys, rather than uppercasing
+// them, for platforms which use lowercase variables. The flag "log.level" is
+// then looked up as log_level, or app_log_level with Prefix("app_"). Keys
+// returned by a NameMapper are never uppercased.
+func PreserveCase() Option {
+	return func(o *option) {
+		o.preserveCase = true
+	}
+}
+
+// ExactCase returns an Option which looks up the environment variable keys of
+// flags as the Prefix followed by the flag name verbatim, without changing its
+// case or replacing "." and "-", so the flag "log.level" is looked up as
+// log.level, or APP_log.level with Prefix("APP_"). AcronymAware and Separator
+// have no effect, and a NameMapper takes precedence.
+//
+// By default, keys are uppercased, so unprefixed flags such as "path", "home",
+// or "user" are set from well-known variables such as PATH, HOME, and USER,
+// which are almost always set and were never intended for the program. Some
+// platforms, such as Windows, also look up keys regardless of case. With
+// ExactCase, such collisions only occur for flags named exactly like the
+// variables, so it's intended for environments which define variables with
+// precise names. Using a distinctive Prefix avoids the hazard entirely.
+func ExactCase() Option {
+	return func(o *option) {
+		o.exactCase = true
+	}
+}
+
+// FuzzyNames returns an Option which looks up each flag without a KeyChain,
+// Names, or StaticMapping binding under several candidate keys, for mixed
+// environments in which some variables are exported with other names, and
+// uses the first that is set. The candidates are, in order: the derived key,
+// such as APP_LOG_LEVEL for the flag "log-level" with Prefix("APP_"); the flag
+// name verbatim, as in log-level; and the derived key without the prefix, as
+// in LOG_LEVEL. Duplicate candidates are looked up only once.
+func FuzzyNames() Option {
+	return func(o *option) {
+		o.fuzzy = true
+	}
+}
+
+// Separator returns an Option which specifies the string which replaces "."
+// and "-" when deriving environment variable keys from flag names and the
+// Prefix, and which separates words with AcronymAware. If unused, it is "_".
+// For example, with Separator(""), the flag "log.level" is looked up as
+// LOGLEVEL, and with Separator("__"), as LOG__LEVEL.
+func Separator(sep string) Option {
+	return func(o *option) {
+		o.separator = &sep
+	}
+}
+
+// NameMapper returns an Option which replaces the transformation from flag
+// names to environment variable keys, by default uppercasing the name and
+// replacing "." and "-" with "_", with fn. The Prefix, if any, is prepended
+// verbatim to the key returned by fn, which receives the flag name without
+// it. For example, a mapper may map "log.level" to "LOG__LEVEL", looked up as
+// MYAPP__LOG__LEVEL with Prefix("MYAPP__"). AcronymAware has no effect with
+// a mapper. Values are processed as usual, including bool normalization.
+func NameMapper(fn func(flagName string) string) Option {
+	return func(o *option) {
+		o.mapper = fn
+	}
+}
+
+// StaticMapping returns an Option which specifies a precomputed mapping from
+// flag names to environment variable keys. Mapped keys are used verbatim, with
+// no prefix or transformation, so distinct flags such as "log.level" and
+// "log-level" cannot collide. Flags missing from the mapping fall back to the
+// derived key if fallback is true and are not looked up otherwise. KeyChain
+// takes precedence over the mapping.
+//
+// The mapping is intended to be generated at build time, for example by a
+// program run with go generate that registers the application's flags and
+// writes out a Go source file declaring the map, which is reviewed and
+// committed alongside the flags.
+func StaticMapping(mapping map[string]string, fallback bool) Option {
+	return func(o *option) {
+		o.static = mapping
+		o.staticFallback = fallback
+	}
+}
+
+// EnvKey returns the environment variable key from which Parse would first
+// look up the named flag with the given options, honoring options such as
+// Prefix, PreserveCase, Separator, and NameMapper, and those which may differ
+// between flags, such as KeyChain and StaticMapping. It returns the
+// empty string if the flag would not be looked up in the environment. EnvKey
+// does not access the environment, so options which depend on it, such as
+// PrefixWhen, have no effect. It's intended for tooling, such as generating
+// documentation, and for error messages and tests.
+func EnvKey(flagName string, options ...Option) string {
+	o := &option{}
+	for _, opt := range options {
+		opt(o)
+	}
+	if keys := o.primaryKeys(flagName); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// CheckCollisions returns an error if any environment variable key would be
+// looked up by Parse for more than one of the flags of set with the given
+// options, such as for the flags "log.level" and "log-level", which are both
+// looked up as LOG_LEVEL by default, so that one would silently shadow the
+// other. The error lists each such key with the flags which share it. Keys
+// are compared case-insensitively on Windows, where the environment is.
+// Options which depend on the environment, such as PrefixWhen, have no
+// effect. It's intended for tests and for checks at startup.
+func CheckCollisions(set *flag.FlagSet, options ...Option) error {
+	o := &option{}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return o.err
+	}
+	o.set = set
+	flags := make(map[string][]string)
+	var keys []string
+	set.VisitAll(func(f *flag.Flag) {
+		seen := make(map[string]bool)
+		for _, key := range o.keys(f.Name) {
+			if runtime.GOOS == "windows" {
+				key = strings.ToUpper(key)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if len(flags[key]) == 1 {
+				keys = append(keys, key)
+			}
+			flags[key] = append(flags[key], "-"+f.Name)
+		}
+	})
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = fmt.Sprintf("%s (%s)", key, strings.Join(flags[key], ", "))
+	}
+	return fmt.Errorf("envflag: flags share environment variables: %s", strings.Join(msgs, "; "))
+}
+
+// Aliases returns an Option which specifies alternative environment variable
+// keys for flags, given by a mapping from flag names to keys, such as the old
+// names of renamed variables during a transition. Aliases are used verbatim,
+// with no prefix or transformation, and are looked up in order before the
+// flag's other keys, which remain the last fallback, so the first one that is
+// set is used. With WarnAliases, using an alias writes a warning.
+func Aliases(m map[string][]string) Option {
+	return func(o *option) {
+		if o.aliases == nil {
+			o.aliases = make(map[string][]string)
+		}
+		for name, keys := range m {
+			o.aliases[name] = keys
+		}
+	}
+}
+
+// WarnAliases returns an Option which writes a warning to the FlagSet's output
+// when a flag is read from a key given by Aliases, so that operators know to
+// migrate to the flag's primary key.
+func WarnAliases() Option {
+	return func(o *option) {
+		o.warnAliases = true
+	}
+}
+
+// Deprecate returns an Option which writes a warning with message whenever a
+// flag is read from the environment variable key, which is still used, such
+// as an old name given by Aliases or KeyChain during a rename. The warning is
+// written to the FlagSet's output, or the writer given by WarnOutput.
+func Deprecate(key, message string) Option {
+	return func(o *option) {
+		if o.deprecated == nil {
+			o.deprecated = make(map[string]string)
+		}
+		o.deprecated[key] = message
+	}
+}
+
+// useKey records that the named flag was read from key.
+func (o *option) useKey(name, key string) {
+	o.envKeys[name] = key
+	if msg, ok := o.deprecated[key]; ok {
+		o.warnf("flag -%s: %s is deprecated: %s", name, key, msg)
+	}
+	if scoped := o.scopedKeys(name); len(scoped) > 0 {
+		if fb, ok := o.fallbackKey(name, scoped); ok && fb == key {
+			o.warnf("flag -%s: %s is deprecated; use %s", name, key, scoped[0])
+		}
+	}
+	if !o.warnAliases {
+		return
+	}
+	for _, alias := range o.aliases[name] {
+		if alias == key {
+			if primary := o.primaryKeys(name); len(primary) > 0 {
+				o.warnf("flag -%s: %s is deprecated; use %s", name, key, primary[0])
+			} else {
+				o.warnf("flag -%s: %s is deprecated", name, key)
+			}
+			return
+		}
+	}
+}
+
+// Names returns an Option which binds flags to explicitly named environment
+// variables, given by a mapping from flag names to keys, such as when the
+// variables were named before the flags existed. Mapped keys are used
+// verbatim, with no prefix or transformation, and take precedence over
+// derived keys. If fallback is true and a mapped key is not set, the derived
+// key is looked up next; otherwise it is not. Flags missing from the mapping
+// use their derived keys. Unlike StaticMapping, which is intended to be
+// complete, Names is intended for a few exceptions. KeyChain takes precedence
+// over Names.
+func Names(m map[string]string, fallback bool) Option {
+	return func(o *option) {
+		if o.names == nil {
+			o.names = make(map[string]string)
+		}
+		for name, key := range m {
+			o.names[name] = key
+		}
+		o.namesFallback = fallback
+	}
+}
+
+// keys returns the environment variable keys for the named flag,
+// in the order in which they should be looked up.
+func (o *option) keys(name string) []string {
+	if aliases, ok := o.aliases[name]; ok {
+		return append(append([]string(nil), aliases...), o.primaryKeys(name)...)
+	}
+	return o.primaryKeys(name)
+}
+
+// primaryKeys returns the keys for the named flag, excluding any Aliases.
+func (o *option) primaryKeys(name string) []string {
+	if chain, ok := o.chains[name]; ok {
+		var keys []string
+		for _, k := range chain {
+			if strings.HasPrefix(k, "/") {
+				keys = append(keys, k[1:])
+			} else {
+				keys = append(keys, o.prefixedKeys(k)...)
+			}
+		}
+		return keys
+	}
+	if key, ok := o.names[name]; ok {
+		if !o.namesFallback {
+			return []string{key}
+		}
+		return append([]string{key}, o.defaultKeys(name)...)
+	}
+	return o.defaultKeys(name)
+}
+
+// defaultKeys returns the keys for a flag without a KeyChain or Names binding.
+func (o *option) defaultKeys(name string) []string {
+	if key, ok := o.static[name]; ok {
+		return []string{key}
+	}
+	if o.static != nil && !o.staticFallback {
+		return nil
+	}
+	keys := o.prefixedKeys(name)
+	if o.fuzzy {
+		for _, key := range []string{name, o.envKey("", name)} {
+			if !contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixedKeys returns the environment variable keys for a flag name,
+// one for each prefix in the order in which they should be looked up.
+func (o *option) prefixedKeys(name string) []string {
+	keys := o.scopedKeys(name)
+	if key, ok := o.fallbackKey(name, keys); ok {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// scopedKeys returns the keys for a flag name with each prefix.
+func (o *option) scopedKeys(name string) []string {
+	group, name := o.group(name)
+	group = o.joinPrefix(group)
+	if len(o.prefixes) == 0 {
+		return []string{o.prefixedKey(o.joinPrefix(o.prefix)+group, name)}
+	}
+	keys := make([]string, len(o.prefixes))
+	for i, prefix := range o.prefixes {
+		keys[i] = o.prefixedKey(o.joinPrefix(prefix)+group, name)
+	}
+	return keys
+}
+
+// PrefixFallback returns an Option which looks up each flag by its key
+// without the Prefix, or any of the Prefixes, after those with them, such as
+// while introducing a prefix to deployments which still define unprefixed
+// variables, so that with Prefix("APP_"), the flag "log.level" is looked up as
+// APP_LOG_LEVEL and then as LOG_LEVEL. With Prefixes, the unprefixed key is
+// looked up once, after all of the prefixed keys, unless one of the prefixes
+// is empty. Using the unprefixed key writes a warning, so that operators know
+// to migrate to the prefixed key.
+func PrefixFallback() Option {
+	return func(o *option) {
+		o.prefixFallback = true
+	}
+}
+
+// fallbackKey returns the unprefixed key for a flag name, if PrefixFallback
+// is used and it isn't one of its prefixed keys.
+func (o *option) fallbackKey(name string, keys []string) (string, bool) {
+	if !o.prefixFallback {
+		return "", false
+	}
+	group, name := o.group(name)
+	key := o.prefixedKey(o.joinPrefix(group), name)
+	return key, !contains(keys, key)
+}
+
+// joinPrefix returns prefix followed by the Separator, or "_" with ExactCase,
+// unless it's empty, it already ends with a separator, "_", ".", or "-", or
+// a NameMapper is used, so that Prefix("APP") and Prefix("APP_") are alike.
+func (o *option) joinPrefix(prefix string) string {
+	if prefix == "" || o.mapper != nil {
+		return prefix
+	}
+	sep := "_"
+	if o.separator != nil && !o.exactCase {
+		sep = *o.separator
+	}
+	if strings.HasSuffix(prefix, sep) || strings.ContainsAny(prefix[len(prefix)-1:], "_.-") {
+		return prefix
+	}
+	return prefix + sep
+}
+
+// StripRedundantPrefix returns an Option which doesn't apply the Prefix, or
+// any of the Prefixes, to the key of a flag whose name already begins with
+// it, comparing the keys derived with and without it case-insensitively, so
+// that with Prefix("APP_") the flag "app.log.level" is looked up as
+// APP_LOG_LEVEL rather than APP_APP_LOG_LEVEL, while the flag "log.level" is
+// still looked up as APP_LOG_LEVEL.
+func StripRedundantPrefix() Option {
+	return func(o *option) {
+		o.stripPrefix = true
+	}
+}
+
+// prefixedKey returns the environment variable key for a flag name with
+// prefix, unless the prefix is redundant with StripRedundantPrefix.
+func (o *option) prefixedKey(prefix, name string) string {
+	key := o.envKey(prefix, name)
+	if !o.stripPrefix || prefix == "" {
+		return key
+	}
+	bare := o.envKey("", name)
+	if len(key) <= len(bare) || !strings.HasSuffix(key, bare) {
+		return key
+	}
+	p := key[:len(key)-len(bare)]
+	if len(bare) > len(p) && strings.EqualFold(bare[:len(p)], p) {
+		return bare
+	}
+	return key
+}
+
+// GroupPrefixes returns an Option which specifies prefixes for groups of
+// flags, given by a mapping from prefixes of flag names, such as "server.",
+// to prefixes of environment variable keys, such as "SRV_", which replace
+// them when deriving keys. The key prefix follows the Prefix, if any, so with
+// Prefix("APP_") and
+//
+//	GroupPrefixes(map[string]string{"server.": "SRV_"})
+//
+// the flag "server.port" is looked up as APP_SRV_PORT, rather than as
+// APP_SERVER_PORT. If several flag name prefixes match, the longest is used.
+// Keys given by Names, StaticMapping, Aliases, or absolute KeyChain keys are
+// unaffected.
+func GroupPrefixes(m map[string]string) Option {
+	return func(o *option) {
+		if o.groups == nil {
+			o.groups = make(map[string]string)
+		}
+		for prefix, envPrefix := range m {
+			o.groups[prefix] = envPrefix
+		}
+	}
+}
+
+// group returns the key prefix of the group of the named flag, if any, and
+// the name without the group's flag name prefix.
+func (o *option) group(name string) (string, string) {
+	match := ""
+	for prefix := range o.groups {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return "", name
+	}
+	return o.groups[match], name[len(match):]
+}
+
+// envKey returns the environment variable key for a flag name with prefix.
+func (o *option) envKey(prefix, name string) string {
+	if o.mapper != nil {
+		return prefix + o.mapper(name)
+	}
+	if o.resolver != nil {
+		return o.resolver.key(o, prefix, name)
+	}
+	return o.deriveKey(prefix, name)
+}
+
+// deriveKey derives the environment variable key for a flag name with prefix.
+func (o *option) deriveKey(prefix, name string) string {
+	if o.exactCase {
+		return prefix + name
+	}
+	sep := "_"
+	if o.separator != nil {
+		sep = *o.separator
+	}
+	if o.acronyms {
+		name = splitWords(name, sep)
+	}
+	key := prefix + name
+	if !o.preserveCase {
+		key = strings.ToUpper(key)
+	}
+	key = strings.Replace(key, ".", sep, -1)
+	key = strings.Replace(key, "-", sep, -1)
+	return key
+}
+
+// splitWords inserts sep at the word boundaries of a camel-cased name. A
+// lower-case "s" ending a word after an acronym is taken as its plural.
+func splitWords(name, sep string) string {
+	r := []rune(name)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			next := i+1 < len(r) && unicode.IsLower(r[i+1]) && !plural(r[i+1:])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteString(sep)
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// plural reports whether r begins with a lower-case "s" which ends a word.
+func plural(r []rune) bool {
+	return r[0] == 's' && (len(r) == 1 || !unicode.IsLower(r[1]))
+}
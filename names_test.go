@@ -0,0 +1,224 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAcronymAware(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"simple", "SIMPLE"},
+		{"already_snake", "ALREADY_SNAKE"},
+		{"apiKey", "API_KEY"},
+		{"apiKeyID", "API_KEY_ID"},
+		{"userID", "USER_ID"},
+		{"userIDs", "USER_IDS"},
+		{"URLsList", "URLS_LIST"},
+		{"HTTPSettings", "HTTP_SETTINGS"},
+		{"ID", "ID"},
+		{"x", "X"},
+		{"HTTPServer", "HTTP_SERVER"},
+		{"getHTTPResponseCode", "GET_HTTP_RESPONSE_CODE"},
+		{"oauth2Token", "OAUTH2_TOKEN"},
+		{"ipv6Addr", "IPV6_ADDR"},
+		{"base64Value", "BASE64_VALUE"},
+		{"tlsV13", "TLS_V13"},
+		{"db.maxConns", "DB_MAX_CONNS"},
+		{"log-levelName", "LOG_LEVEL_NAME"},
+	}
+	o := &option{}
+	AcronymAware()(o)
+	for _, tt := range tests {
+		if got := o.envKey(o.prefix, tt.name); got != tt.want {
+			t.Errorf("%s: want: %s; got: %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"log-level", nil, "LOG_LEVEL"},
+		{"log.level", []Option{Prefix("APP_")}, "APP_LOG_LEVEL"},
+		{"apiKey", []Option{Prefix("APP_"), AcronymAware()}, "APP_API_KEY"},
+		{"token", []Option{KeyChain("token", "secret", "/TOKEN")}, "SECRET"},
+		{"level", []Option{StaticMapping(map[string]string{"level": "LVL"}, false)}, "LVL"},
+		{"log.level", []Option{Prefix("X__"), NameMapper(strings.ToLower)}, "X__log.level"},
+		{"log.level", []Option{Separator("")}, "LOGLEVEL"},
+		{"log-level", []Option{Prefix("my.app."), Separator("__")}, "MY__APP__LOG__LEVEL"},
+		{"db.maxConns", []Option{AcronymAware(), Separator("__")}, "DB__MAX__CONNS"},
+		{"log.level", []Option{PreserveCase(), Prefix("app-")}, "app_log_level"},
+		{"log.level", []Option{Prefixes("A_", "B_")}, "A_LOG_LEVEL"},
+		{"log.level", []Option{Prefixes("A_", "B_"), Prefix("C_")}, "C_LOG_LEVEL"},
+		{"log.level", []Option{Prefix("C_"), Prefixes("", "B_")}, "LOG_LEVEL"},
+		{"log.level", []Option{ExactCase(), Prefix("APP_"), AcronymAware()}, "APP_log.level"},
+		{"Path", []Option{ExactCase(), Separator("__")}, "Path"},
+		{"other", []Option{StaticMapping(map[string]string{"level": "LVL"}, false)}, ""},
+		{"log.level", []Option{Prefix("APP")}, "APP_LOG_LEVEL"},
+		{"log.level", []Option{Prefix("app"), PreserveCase()}, "app_log_level"},
+		{"log.level", []Option{Prefix("APP"), Separator("__")}, "APP__LOG__LEVEL"},
+		{"log.level", []Option{Prefix("APP__"), Separator("__")}, "APP__LOG__LEVEL"},
+		{"log.level", []Option{Prefix("APP_"), Separator("__")}, "APP_LOG__LEVEL"},
+		{"log.level", []Option{Prefix("APP"), Separator("")}, "APPLOGLEVEL"},
+		{"log.level", []Option{Prefix("APP"), ExactCase(), Separator("__")}, "APP_log.level"},
+		{"log.level", []Option{Prefix("APP"), NameMapper(strings.ToUpper)}, "APPLOG.LEVEL"},
+		{"log.level", []Option{Prefixes("A", "B_")}, "A_LOG_LEVEL"},
+		{"server.port", []Option{Prefix("APP"), GroupPrefixes(map[string]string{"server.": "SRV"})}, "APP_SRV_PORT"},
+		{"port", []Option{Prefix("APP_"), AutoPrefix()}, "APP_PORT"},
+		{"app.log.level", []Option{Prefix("APP_"), StripRedundantPrefix()}, "APP_LOG_LEVEL"},
+		{"App-Name", []Option{Prefix("app."), StripRedundantPrefix(), PreserveCase()}, "App_Name"},
+		{"app.log.level", []Option{Prefix("APP_")}, "APP_APP_LOG_LEVEL"},
+		{"application.name", []Option{Prefix("APP_"), StripRedundantPrefix()}, "APP_APPLICATION_NAME"},
+		{"app", []Option{Prefix("APP_"), StripRedundantPrefix()}, "APP_APP"},
+		{"app.port", []Option{Prefixes("SVC_", "APP_"), StripRedundantPrefix()}, "SVC_APP_PORT"},
+		{"server.port", []Option{GroupPrefixes(map[string]string{"server.": "SRV_"})}, "SRV_PORT"},
+		{"server.port", []Option{Prefix("APP_"), GroupPrefixes(map[string]string{"server.": "srv."})}, "APP_SRV_PORT"},
+		{"server.tls.cert", []Option{GroupPrefixes(map[string]string{"server.": "SRV_", "server.tls.": "TLS_"})}, "TLS_CERT"},
+		{"client.timeout", []Option{GroupPrefixes(map[string]string{"server.": "SRV_"})}, "CLIENT_TIMEOUT"},
+		{"server.port", []Option{Prefixes("A_", "B_"), GroupPrefixes(map[string]string{"server.": "S_"})}, "A_S_PORT"},
+		{"server.port", []Option{GroupPrefixes(map[string]string{"server.": "SRV_"}), Names(map[string]string{"server.port": "PORT"}, false)}, "PORT"},
+		{"port", []Option{AutoPrefix(), Prefixes("APP_")}, "APP_PORT"},
+	}
+	for _, tt := range tests {
+		if got := EnvKey(tt.name, tt.opts...); got != tt.want {
+			t.Errorf("%s: want: %q; got: %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestEnvKeyParse(t *testing.T) {
+	defer resetEnv()()
+	opts := [][]Option{
+		{Prefix("app-"), PreserveCase()},
+		{Prefix("APP__"), NameMapper(strings.ToUpper)},
+		{Prefix("app."), Separator("__"), AcronymAware()},
+		{GroupPrefixes(map[string]string{"server.": "SRV_"})},
+	}
+	for _, name := range []string{"server.httpPort", "log-level"} {
+		for _, opt := range opts {
+			key := EnvKey(name, opt...)
+			setEnv([]string{key + "=1"})
+			set := flag.NewFlagSet("env_key", flag.ContinueOnError)
+			set.String(name, "", "")
+			res, err := ParseWithResult(append(opt, FlagSet(set), Args(nil))...)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			if got := res.Keys[name]; got != key {
+				t.Errorf("%s: want: %q; got: %q", name, key, got)
+			}
+		}
+	}
+}
+
+func TestCheckCollisions(t *testing.T) {
+	set := flag.NewFlagSet("collisions", flag.ContinueOnError)
+	set.String("log.level", "", "")
+	set.String("log-level", "", "")
+	set.String("Log_Level", "", "")
+	set.String("port", "", "")
+	set.String("addr", "", "")
+	set.String("old.port", "", "")
+	err := CheckCollisions(set, Prefix("APP"), Aliases(map[string][]string{"addr": {"APP_PORT"}}))
+	want := "envflag: flags share environment variables: APP_LOG_LEVEL (-Log_Level, -log-level, -log.level); APP_PORT (-addr, -port)"
+	if err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+	if err := CheckCollisions(set, StaticMapping(map[string]string{"log.level": "LOG_LEVEL", "log-level": "LEVEL", "Log_Level": "LL"}, true)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPrefixFallback(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		want []string
+	}{
+		{[]Option{Prefix("APP_"), PrefixFallback()}, []string{"APP_LOG_LEVEL", "LOG_LEVEL"}},
+		{[]Option{Prefixes("A_", "B_"), PrefixFallback()}, []string{"A_LOG_LEVEL", "B_LOG_LEVEL", "LOG_LEVEL"}},
+		{[]Option{Prefixes("A_", ""), PrefixFallback()}, []string{"A_LOG_LEVEL", "LOG_LEVEL"}},
+		{[]Option{PrefixFallback()}, []string{"LOG_LEVEL"}},
+	}
+	for _, tt := range tests {
+		o := &option{}
+		for _, opt := range tt.opts {
+			opt(o)
+		}
+		if got := o.keys("log.level"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("want: %q; got: %q", tt.want, got)
+		}
+	}
+
+	defer resetEnv()()
+	setEnv([]string{"LOG_LEVEL=debug", "APP_PORT=80", "PORT=1"})
+	set := flag.NewFlagSet("prefix_fallback", flag.ContinueOnError)
+	var warn bytes.Buffer
+	set.SetOutput(&warn)
+	level := set.String("log.level", "", "")
+	port := set.Int("port", 0, "")
+	if err := Parse(FlagSet(set), Args(nil), Prefix("APP"), PrefixFallback()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *level != "debug" || *port != 80 {
+		t.Errorf("unexpected values: level=%q port=%d", *level, *port)
+	}
+	if want := "envflag: flag -log.level: LOG_LEVEL is deprecated; use APP_LOG_LEVEL\n"; warn.String() != want {
+		t.Errorf("warnings: want: %q; got: %q", want, warn.String())
+	}
+}
+
+func TestProgramPrefix(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"myapp", "MYAPP_"},
+		{"/usr/local/bin/my-app", "MY_APP_"},
+		{"./my.app.v2", "MY_APP_V2_"},
+		{"/opt/My App/MyApp.EXE", "MYAPP_"},
+		{"myapp.exe", "MYAPP_"},
+		{"app_", "APP_"},
+		{"café", "CAF_"},
+		{"", ""},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		if got := programPrefix(filepath.FromSlash(tt.path)); got != tt.want {
+			t.Errorf("%q: want: %q; got: %q", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestFuzzyNames(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"log-level", []Option{Prefix("APP_"), FuzzyNames()}, []string{"APP_LOG_LEVEL", "log-level", "LOG_LEVEL"}},
+		{"log-level", []Option{FuzzyNames()}, []string{"LOG_LEVEL", "log-level"}},
+		{"PORT", []Option{FuzzyNames()}, []string{"PORT"}},
+		{"log-level", []Option{Prefixes("A_", "B_"), FuzzyNames()}, []string{"A_LOG_LEVEL", "B_LOG_LEVEL", "log-level", "LOG_LEVEL"}},
+		{"log-level", []Option{Prefix("APP_"), FuzzyNames(), Names(map[string]string{"log-level": "LVL"}, false)}, []string{"LVL"}},
+		{"log-level", []Option{Prefix("APP_")}, []string{"APP_LOG_LEVEL"}},
+	}
+	for _, tt := range tests {
+		o := &option{}
+		for _, opt := range tt.opts {
+			opt(o)
+		}
+		if got := o.keys(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: want: %q; got: %q", tt.name, tt.want, got)
+		}
+	}
+}
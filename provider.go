@@ -0,0 +1,40 @@
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// A Provider is a source of typed flag values, such as a decoded JSON object.
+// Keys are flag names. The boolean result reports whether the key is present.
+type Provider interface {
+	GetString(key string) (string, bool)
+	GetInt(key string) (int, bool, error)
+}
+
+// TypedSource returns an Option which specifies a Provider to consult for
+// flags set by neither the argument list nor the environment. The Provider
+// method is chosen by the type of the flag's value, as reported by its Get
+// method, falling back to GetString for other types. Since a flag.Value can
+// only be set from a string, typed values are formatted losslessly before
+// being passed to the flag's Set method.
+func TypedSource(p Provider) Option {
+	return func(o *option) {
+		o.provider = p
+	}
+}
+
+func (o *option) provide(f *flag.Flag) (string, bool, error) {
+	if g, ok := f.Value.(flag.Getter); ok {
+		if _, ok := g.Get().(int); ok {
+			n, ok, err := o.provider.GetInt(f.Name)
+			if err != nil {
+				return "", false, fmt.Errorf("envflag: flag -%s: %v", f.Name, err)
+			}
+			return strconv.Itoa(n), ok, nil
+		}
+	}
+	v, ok := o.provider.GetString(f.Name)
+	return v, ok, nil
+}
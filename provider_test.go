@@ -0,0 +1,51 @@
+package envflag
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"testing"
+)
+
+type mapProvider map[string]interface{}
+
+func (p mapProvider) GetString(key string) (string, bool) {
+	v, ok := p[key].(string)
+	return v, ok
+}
+
+func (p mapProvider) GetInt(key string) (int, bool, error) {
+	v, ok := p[key]
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok := v.(int)
+	if !ok {
+		return 0, false, errors.New("not an int")
+	}
+	return n, true, nil
+}
+
+func TestTypedSource(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"ENV=from_env"})
+	set := flag.NewFlagSet("typed", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	n := set.Int("n", 0, "")
+	s := set.String("s", "", "")
+	e := set.String("env", "", "")
+	a := set.Int("arg", 0, "")
+	p := mapProvider{"n": 42, "s": "str", "env": "from_provider", "arg": 7}
+	if err := Parse(FlagSet(set), Args([]string{"--arg=1"}), TypedSource(p)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *n != 42 || *s != "str" || *e != "from_env" || *a != 1 {
+		t.Errorf("unexpected values: n=%d s=%q env=%q arg=%d", *n, *s, *e, *a)
+	}
+
+	set = flag.NewFlagSet("typed", flag.ContinueOnError)
+	set.Int("n", 0, "")
+	if err := Parse(FlagSet(set), Args(nil), TypedSource(mapProvider{"n": "NaN"})); err == nil {
+		t.Error("expected error")
+	}
+}
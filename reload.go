@@ -0,0 +1,171 @@
+package envflag
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+	"time"
+)
+
+// A Change is a change to the value of a flag.
+type Change struct {
+	Name string // flag name
+	Old  string // current value
+	New  string // resolved value
+}
+
+// ReloadDiff resolves the flags of set from their defaults, the argument list,
+// and the environment as Parse would, and returns the changes from their
+// current values without applying them. Since the set itself is not modified,
+// flags are resolved on a copy of it, and only flags of the types defined by
+// the flag package, which can be copied, are included. Options which act on
+// the resolved values, such as AfterSet and ProvenanceFile, have no effect.
+func ReloadDiff(set *flag.FlagSet, options ...Option) ([]Change, error) {
+	clone := cloneSet(set)
+	options = append(options, FlagSet(clone), dryRun())
+	if err := Parse(options...); err != nil {
+		return nil, err
+	}
+	var changes []Change
+	clone.VisitAll(func(f *flag.Flag) {
+		old := set.Lookup(f.Name).Value.String()
+		if v := f.Value.String(); v != old {
+			changes = append(changes, Change{Name: f.Name, Old: old, New: v})
+		}
+	})
+	return changes, nil
+}
+
+// ApplyChanges sets the flags of set to the new values of the changes.
+func ApplyChanges(set *flag.FlagSet, changes []Change) error {
+	var errs []error
+	for _, c := range changes {
+		if err := set.Set(c.Name, c.New); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadOptions returns the options of a Parse for Watch and WatchSignal to
+// resolve the flags again. Options which report on or record a Parse, such as
+// ErrorCollector, RawValues, OnEnvSet, and warnings, are disabled, since they
+// would be repeated and would run concurrently with the program.
+func reloadOptions(options []Option) []Option {
+	return append(options[:len(options):len(options)], func(o *option) {
+		o.collector, o.raw, o.onEnvSet, o.onComplete = nil, nil, nil, nil
+		o.provenance, o.metrics, o.logger = "", nil, nil
+		o.log, o.warnOut = nil, io.Discard
+	})
+}
+
+func dryRun() Option {
+	return func(o *option) {
+		o.dryRun = true
+	}
+}
+
+// Watch returns an Option which, after a successful Parse, re-resolves the
+// flags every interval until ctx is done, as ReloadDiff does with the same
+// options, and applies any changes before passing them to onChange. To debounce
+// rapid changes, changes are only applied once the same changes are resolved
+// on two consecutive intervals. Resolution errors leave the flags unchanged.
+// Parse fails if interval isn't positive. Options which report on or record a
+// Parse, such as ErrorCollector, RawValues, OnEnvSet, OnComplete, and
+// ProvenanceFile, apply only to the initial Parse, warnings aren't repeated,
+// and readers given to EnvReader aren't read again.
+//
+// Flags are set and onChange is called from a separate goroutine. Neither the
+// flag package nor the flag values it defines are safe for concurrent use,
+// so the program must synchronize any access to watched flags, such as by
+// reading them only in onChange and publishing copies under its own lock.
+func Watch(ctx context.Context, interval time.Duration, onChange func([]Change)) Option {
+	return func(o *option) {
+		if interval <= 0 && o.err == nil {
+			o.err = fmt.Errorf("envflag: watch interval must be positive: %v", interval)
+		}
+		o.watch = &watcher{ctx, interval, onChange}
+	}
+}
+
+type watcher struct {
+	ctx      context.Context
+	interval time.Duration
+	onChange func([]Change)
+}
+
+func (w *watcher) run(set *flag.FlagSet, options []Option) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	var pending []Change
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-t.C:
+		}
+		changes, err := ReloadDiff(set, reloadOptions(options)...)
+		if err != nil || len(changes) == 0 || !reflect.DeepEqual(changes, pending) {
+			pending = changes
+			continue
+		}
+		pending = nil
+		ApplyChanges(set, changes)
+		w.onChange(changes)
+	}
+}
+
+// WatchSignal returns an Option which, after a successful Parse, re-resolves
+// the flags whenever the process receives sig, such as syscall.SIGHUP, until
+// ctx is done, as ReloadDiff does with the same options, applies any changes,
+// and then passes the error, if any, to onReload, which may be nil. A value
+// from the argument list is only replaced if another source takes precedence
+// over it, such as with Precedence(EnvFirst), since the same argument list is
+// parsed again. Only flags which ReloadDiff can copy are reloaded. The
+// process's own environment only changes by calls such as os.Setenv, so this
+// is most useful with sources which are read again, such as files given to
+// EnvFile or FileIndirection, or a LookupSource. Resolution errors leave the
+// flags unchanged. Options apply to the reloads as for Watch.
+//
+// The signal is registered before Parse returns. Flags are set and onReload
+// is called from a separate goroutine, with the same implications as for
+// Watch: the program must synchronize any access to the flags, such as by
+// reading them only in onReload and publishing copies under its own lock.
+func WatchSignal(ctx context.Context, sig os.Signal, onReload func(error)) Option {
+	return func(o *option) {
+		o.signals = append(o.signals, &signalWatcher{ctx, sig, onReload})
+	}
+}
+
+type signalWatcher struct {
+	ctx      context.Context
+	sig      os.Signal
+	onReload func(error)
+}
+
+func (w *signalWatcher) start(set *flag.FlagSet, options []Option) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, w.sig)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ch:
+			}
+			changes, err := ReloadDiff(set, reloadOptions(options)...)
+			if err == nil {
+				err = ApplyChanges(set, changes)
+			}
+			if w.onReload != nil {
+				w.onReload(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,296 @@
+package envflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadDiff(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=80", "TIMEOUT=1m", "NAME=a"})
+	set := flag.NewFlagSet("reload", flag.ContinueOnError)
+	port := set.Int("port", 0, "")
+	timeout := set.Duration("timeout", 0, "")
+	name := set.String("name", "", "")
+	set.Var(&stringList{}, "list", "")
+	args := []string{"--name=arg"}
+	if err := Parse(FlagSet(set), Args(args)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	setEnv([]string{"PORT=8080", "TIMEOUT=60s", "NAME=b", "LIST=x"})
+	changes, err := ReloadDiff(set, Args(args))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Change{{Name: "port", Old: "80", New: "8080"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("changes: want: %v; got: %v", want, changes)
+	}
+	if *port != 80 {
+		t.Fatalf("port changed before apply: %d", *port)
+	}
+	if err := ApplyChanges(set, changes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 8080 || *timeout != time.Minute || *name != "arg" {
+		t.Errorf("unexpected values: port=%d timeout=%v name=%q", *port, *timeout, *name)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=80"})
+	set := flag.NewFlagSet("watch", flag.ContinueOnError)
+	port := set.Int("port", 0, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan []Change, 1)
+	if err := Parse(FlagSet(set), Args(nil), Watch(ctx, time.Millisecond, func(c []Change) { ch <- c })); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 80 {
+		t.Fatalf("port: want: 80; got: %d", *port)
+	}
+	os.Setenv("PORT", "8080")
+	select {
+	case changes := <-ch:
+		want := []Change{{Name: "port", Old: "80", New: "8080"}}
+		if !reflect.DeepEqual(changes, want) {
+			t.Errorf("changes: want: %v; got: %v", want, changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	cancel()
+	if *port != 8080 {
+		t.Errorf("port: want: 8080; got: %d", *port)
+	}
+}
+
+func TestWatchReload(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=80"})
+	set := flag.NewFlagSet("watch", flag.ContinueOnError)
+	port := set.Int("port", 0, "")
+	name := set.String("name", "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan []Change, 1)
+	var setCalls []string
+	var errs []error
+	raw := make(map[string]string)
+	err := Parse(FlagSet(set), Args(nil), EnvReader(strings.NewReader("NAME=reader\n")),
+		OnEnvSet(func(flagName, _, _ string) { setCalls = append(setCalls, flagName) }),
+		ErrorCollector(&errs), RawValues(&raw),
+		Watch(ctx, time.Millisecond, func(c []Change) { ch <- c }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 80 || *name != "reader" {
+		t.Fatalf("unexpected values: port=%d name=%q", *port, *name)
+	}
+	os.Setenv("PORT", "8080")
+	select {
+	case changes := <-ch:
+		want := []Change{{Name: "port", Old: "80", New: "8080"}}
+		if !reflect.DeepEqual(changes, want) {
+			t.Errorf("changes: want: %v; got: %v", want, changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	cancel()
+	if *name != "reader" {
+		t.Errorf("name: want: %q; got: %q", "reader", *name)
+	}
+	if want := []string{"name", "port"}; !reflect.DeepEqual(setCalls, want) {
+		t.Errorf("OnEnvSet: want: %q; got: %q", want, setCalls)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	set := flag.NewFlagSet("watch", flag.ContinueOnError)
+	set.Int("port", 0, "")
+	err := Parse(FlagSet(set), Args(nil), Watch(context.Background(), 0, func([]Change) {}))
+	if want := "envflag: watch interval must be positive: 0s"; err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+}
+
+func TestWatchSignal(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=80", "NAME=env"})
+	set := flag.NewFlagSet("watch_signal", flag.ContinueOnError)
+	port := set.Int("port", 0, "")
+	name := set.String("name", "", "")
+	host := set.String("host", "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan error, 1)
+	var calls int
+	err := Parse(FlagSet(set), Args([]string{"-name=arg"}), EnvReader(strings.NewReader("HOST=reader")),
+		OnEnvSet(func(string, string, string) { calls++ }),
+		WatchSignal(ctx, syscall.SIGHUP, func(err error) { ch <- err }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	os.Setenv("PORT", "8080")
+	os.Setenv("NAME", "reloaded")
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("cannot signal: %v", err)
+	}
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+	cancel()
+	if *port != 8080 || *name != "arg" || *host != "reader" {
+		t.Errorf("unexpected values: port=%d name=%q host=%q", *port, *name, *host)
+	}
+	if calls != 2 {
+		t.Errorf("OnEnvSet calls: want: 2; got: %d", calls)
+	}
+}
+
+func TestParseInto(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_PORT=1"})
+	set := flag.NewFlagSet("parse_into", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	port := set.Int("port", 80, "port")
+	name := set.String("name", "default", "name")
+	set.Var(new(stringList), "list", "not cloned")
+	type tenantKey struct{}
+	tenants := map[string]map[string]string{
+		"a": {"APP_PORT": "8001", "APP_NAME": "alpha"},
+		"b": {"APP_PORT": "8002"},
+	}
+	lookup := func(ctx context.Context, key string) (string, bool) {
+		v, ok := tenants[ctx.Value(tenantKey{}).(string)][key]
+		return v, ok
+	}
+	for _, tt := range []struct {
+		tenant string
+		want   map[string]string
+	}{
+		{tenant: "a", want: map[string]string{"port": "8001", "name": "alpha"}},
+		{tenant: "b", want: map[string]string{"port": "8002", "name": "default"}},
+	} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tt.tenant)
+		clone, err := ParseInto(ctx, set, lookup, Prefix("APP_"))
+		if err != nil {
+			t.Fatalf("tenant %s: unexpected error: %v", tt.tenant, err)
+		}
+		got := make(map[string]string)
+		clone.VisitAll(func(f *flag.Flag) { got[f.Name] = f.Value.String() })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tenant %s: want: %v; got: %v", tt.tenant, tt.want, got)
+		}
+	}
+	if *port != 80 || *name != "default" {
+		t.Errorf("original set modified: port=%d name=%q", *port, *name)
+	}
+}
+
+func TestReset(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"HOST=env"})
+	set := flag.NewFlagSet("reset", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	host := set.String("host", "localhost", "")
+	port := set.Int("port", 80, "listen port")
+	if err := Parse(FlagSet(set), Args([]string{"-host=arg", "-port=8080"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	set, err := Reset(set)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *host != "localhost" || *port != 80 {
+		t.Errorf("not reset: host=%q port=%d", *host, *port)
+	}
+	if f := set.Lookup("port"); f.DefValue != "80" || f.Usage != "listen port" {
+		t.Errorf("port: unexpected flag: %+v", f)
+	}
+	if err := Parse(FlagSet(set), Args(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *host != "env" || *port != 80 {
+		t.Errorf("unexpected values after reparse: host=%q port=%d", *host, *port)
+	}
+
+	set = flag.NewFlagSet("reset", flag.ContinueOnError)
+	set.Func("level", "", func(s string) error {
+		if s == "" {
+			return errors.New("empty level")
+		}
+		return nil
+	})
+	if _, err := Reset(set); err == nil || err.Error() != "envflag: resetting flag -level: empty level" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=8080", "TAGS=a,b", "TOKEN=secret", "VERBOSE=yes"})
+	set := flag.NewFlagSet("dry_run", flag.ExitOnError)
+	port := set.Int("port", 80, "")
+	name := set.String("name", "default", "")
+	token := set.String("token", "", "")
+	verbose := set.Bool("verbose", false, "")
+	var tags stringList
+	set.Var(&tags, "tags", "")
+	set.Var(&tags, "more", "")
+	res, err := DryRun(FlagSet(set), Args([]string{"-name=arg", "rest"}), SplitValues("", "tags"), Redact("token"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 80 || *name != "default" || *token != "" || *verbose || tags != nil {
+		t.Errorf("flags changed: port=%d name=%q token=%q verbose=%v tags=%q", *port, *name, *token, *verbose, tags)
+	}
+	want := map[string]string{"port": "8080", "name": "arg", "token": "[redacted]", "verbose": "true", "tags": "a,b", "more": ""}
+	if !reflect.DeepEqual(res.Values, want) {
+		t.Errorf("values: want: %v; got: %v", want, res.Values)
+	}
+	if res.Sources["port"] != SourceEnv || res.Sources["name"] != SourceArg || res.Sources["more"] != SourceDefault {
+		t.Errorf("unexpected sources: %v", res.Sources)
+	}
+	if want := []string{"rest"}; !reflect.DeepEqual(res.Args, want) {
+		t.Errorf("args: want: %q; got: %q", want, res.Args)
+	}
+
+	setEnv([]string{"PORT=x"})
+	secret := flag.NewFlagSet("dry_run", flag.ContinueOnError)
+	SecretVar(secret, "token", "")
+	res, err = DryRun(FlagSet(secret), Args(nil), Env([]string{"TOKEN=hunter2"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := res.Values["token"]; got != "[redacted]" {
+		t.Errorf("secret value: want: %q; got: %q", "[redacted]", got)
+	}
+	if _, err := DryRun(FlagSet(set), Args([]string{"-name=arg"})); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := DryRun(FlagSet(set), Args([]string{"-unknown"})); err == nil {
+		t.Error("expected error")
+	}
+}
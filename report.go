@@ -0,0 +1,355 @@
+package envflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[redacted]"
+
+// Redact returns an Option which marks the named flags as sensitive, so that
+// their values are redacted from any report that Parse produces and from its
+// errors, including those for invalid values in the argument list, and their
+// default values are redacted from the usage message. Flags with Secret
+// values are always treated as sensitive.
+func Redact(names ...string) Option {
+	return func(o *option) {
+		if o.redact == nil {
+			o.redact = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.redact[name] = true
+		}
+	}
+}
+
+// A Format is the format of a report.
+type Format int
+
+// Report formats.
+const (
+	FormatText Format = iota // one line of space-separated key=value pairs per flag
+	FormatJSON               // a JSON array with one object per flag
+)
+
+// ProvenanceFile returns an Option which, after a successful Parse, writes a
+// file at path recording each flag's final value, the source it came from,
+// and the environment variable key, if any, from which it was read. The values
+// of flags marked by Redact are replaced by "[redacted]". The file is created
+// readable only by its owner, and isn't written if Parse fails, so that an
+// earlier record isn't replaced by that of a rejected configuration.
+func ProvenanceFile(path string, format Format) Option {
+	return func(o *option) {
+		o.provenance = path
+		o.provenanceFormat = format
+	}
+}
+
+type provenance struct {
+	Flag   string `json:"flag"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Key    string `json:"key,omitempty"`
+}
+
+func (o *option) writeProvenance() error {
+	var records []provenance
+	o.set.VisitAll(func(f *flag.Flag) {
+		records = append(records, provenance{
+			Flag:   f.Name,
+			Value:  o.value(f),
+			Source: o.sources[f.Name].String(),
+			Key:    o.envKeys[f.Name],
+		})
+	})
+	var buf bytes.Buffer
+	switch o.provenanceFormat {
+	case FormatJSON:
+		b, err := json.MarshalIndent(records, "", "\t")
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	default:
+		for _, r := range records {
+			fmt.Fprintf(&buf, "flag=%s value=%q source=%s", r.Flag, r.Value, r.Source)
+			if r.Key != "" {
+				fmt.Fprintf(&buf, " key=%s", r.Key)
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	if err := os.WriteFile(o.provenance, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("envflag: writing provenance: %v", err)
+	}
+	return nil
+}
+
+// SlogHandler returns an Option which, once flags are resolved, emits a
+// debug record to logger for each flag with the attributes "flag", "value",
+// "source", and "key", if the value was read from an environment variable.
+// The values of flags marked by Redact are replaced by "[redacted]".
+func SlogHandler(logger *slog.Logger) Option {
+	return func(o *option) {
+		o.logger = logger
+	}
+}
+
+func (o *option) logFlags() {
+	o.set.VisitAll(func(f *flag.Flag) {
+		attrs := []slog.Attr{
+			slog.String("flag", f.Name),
+			slog.String("value", o.value(f)),
+			slog.String("source", o.sources[f.Name].String()),
+		}
+		if key := o.envKeys[f.Name]; key != "" {
+			attrs = append(attrs, slog.String("key", key))
+		}
+		o.logger.LogAttrs(o.ctx, slog.LevelDebug, "envflag: resolved flag", attrs...)
+	})
+}
+
+// Stats summarizes a successful Parse, such as for exporting metrics.
+type Stats struct {
+	// Sources maps each source to the number of flags whose values came
+	// from it, including SourceDefault for those left at their defaults.
+	Sources map[Source]int
+	// Keys lists the environment variable keys from which flags were read,
+	// in lexicographical order.
+	Keys []string
+	// Required is the number of defined flags named by Required.
+	Required int
+	// Duration is the time taken by Parse, excluding the OnComplete functions.
+	Duration time.Duration
+}
+
+// OnComplete returns an Option which calls fn with Stats summarizing Parse
+// once it succeeds, after the flags are set and validated and every file given
+// to options such as ProvenanceFile is written. If the option is given more
+// than once, each function is called in turn.
+func OnComplete(fn func(Stats)) Option {
+	return func(o *option) {
+		o.onComplete = append(o.onComplete, fn)
+	}
+}
+
+// complete calls the OnComplete functions with the Stats of a parse which
+// began at start.
+func (o *option) complete(start time.Time) {
+	stats := Stats{Sources: make(map[Source]int)}
+	o.set.VisitAll(func(f *flag.Flag) {
+		stats.Sources[o.sources[f.Name]]++
+	})
+	keys := make(map[string]bool)
+	for _, key := range o.envKeys {
+		keys[key] = true
+	}
+	stats.Keys = sortedKeys(keys)
+	seen := make(map[string]bool)
+	for _, name := range o.required {
+		if !seen[name] && o.set.Lookup(name) != nil {
+			seen[name] = true
+			stats.Required++
+		}
+	}
+	stats.Duration = time.Since(start)
+	for _, fn := range o.onComplete {
+		fn(stats)
+	}
+}
+
+// MetricsText returns an Option which, once flags are resolved, writes an
+// OpenMetrics text exposition of their values to w. Numeric, duration (in
+// seconds), and bool (as 0 or 1) flags are exposed as samples of the gauge
+// envflag_flag_value, and all other flags as samples of the info metric
+// envflag_flag, each labeled by flag name and source. The values of flags
+// marked by Redact are omitted: they are exposed as info samples without
+// a value label.
+func MetricsText(w io.Writer) Option {
+	return func(o *option) {
+		o.metrics = w
+	}
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (o *option) writeMetrics() error {
+	var gauges, infos bytes.Buffer
+	o.set.VisitAll(func(f *flag.Flag) {
+		labels := fmt.Sprintf(`name="%s",source="%s"`, metricLabelEscaper.Replace(f.Name), o.sources[f.Name])
+		if !o.sensitive(f) {
+			if v, ok := numericValue(f.Value); ok {
+				fmt.Fprintf(&gauges, "envflag_flag_value{%s} %s\n", labels, v)
+				return
+			}
+			labels += fmt.Sprintf(`,value="%s"`, metricLabelEscaper.Replace(f.Value.String()))
+		}
+		fmt.Fprintf(&infos, "envflag_flag_info{%s} 1\n", labels)
+	})
+	var buf bytes.Buffer
+	buf.WriteString("# TYPE envflag_flag_value gauge\n# HELP envflag_flag_value Value of a numeric flag.\n")
+	buf.Write(gauges.Bytes())
+	buf.WriteString("# TYPE envflag_flag info\n# HELP envflag_flag Value of a flag.\n")
+	buf.Write(infos.Bytes())
+	buf.WriteString("# EOF\n")
+	if _, err := o.metrics.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("envflag: writing metrics: %v", err)
+	}
+	return nil
+}
+
+// numericValue returns the value of v formatted as a number, if it is one.
+func numericValue(v flag.Value) (string, bool) {
+	g, ok := v.(flag.Getter)
+	if !ok {
+		return "", false
+	}
+	switch x := g.Get().(type) {
+	case bool:
+		if x {
+			return "1", true
+		}
+		return "0", true
+	case int:
+		return strconv.Itoa(x), true
+	case int64:
+		return strconv.FormatInt(x, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(x), 10), true
+	case uint64:
+		return strconv.FormatUint(x, 10), true
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), true
+	case time.Duration:
+		return strconv.FormatFloat(x.Seconds(), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// WriteEnv writes the current value of each flag in the FlagSet to w as an
+// assignment to the environment variable key from which Parse would first
+// read it with the given options, one per line, so that the resolved
+// configuration can be passed to another process. Values are quoted for the
+// shell if necessary. Flags which would not be read from the environment are
+// skipped, as are flags marked as sensitive by Redact or with Secret values,
+// so that they're not disclosed, and flags given to ReadOnce, so that their
+// values are neither disclosed nor consumed. Like EnvKey, WriteEnv does not access the
+// environment, so options which depend on it have no effect.
+func WriteEnv(w io.Writer, options ...Option) error {
+	o := &option{set: flag.CommandLine}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return o.err
+	}
+	var buf bytes.Buffer
+	o.set.VisitAll(func(f *flag.Flag) {
+		keys := o.primaryKeys(f.Name)
+		if len(keys) == 0 || o.sensitive(f) {
+			return
+		}
+		if _, ok := f.Value.(*readOnce); ok {
+			return
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", keys[0], shellQuote(f.Value.String()))
+	})
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("envflag: writing env: %v", err)
+	}
+	return nil
+}
+
+// shellQuote returns s quoted for a POSIX shell, if necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_@%+=:,./-", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// value returns the string form of the flag's value, redacted if necessary.
+func (o *option) value(f *flag.Flag) string {
+	if o.sensitive(f) {
+		return redacted
+	}
+	return f.Value.String()
+}
+
+// A FlagExplanation describes how Parse would resolve a flag, as returned by
+// Explain.
+type FlagExplanation struct {
+	// Name is the flag's name.
+	Name string
+	// Keys lists the environment variable keys which would be looked up for
+	// the flag, in order. It's empty if the flag wouldn't be read from the
+	// environment, such as if it's named by ArgsOnly.
+	Keys []KeyStatus
+	// Source is the source from which the flag would be set.
+	Source Source
+	// Key is the key from which the flag's value would be read, if any.
+	Key string
+}
+
+// A KeyStatus reports whether an environment variable key is set.
+type KeyStatus struct {
+	Key     string
+	Present bool
+}
+
+// Explain returns an explanation of how Parse would resolve each flag of set
+// with the given options, in lexicographical order, such as to print when a
+// flag doesn't pick up the value of an environment variable. It lists the keys
+// which would be looked up for each flag and whether each is set, and the
+// source which would set the flag, as resolved by DryRun, leaving the flags
+// unchanged. Values aren't included, so that secrets aren't exposed. If the
+// options are invalid, Explain returns nil.
+func Explain(set *flag.FlagSet, options ...Option) []FlagExplanation {
+	o := &option{
+		lookup:  os.LookupEnv,
+		environ: environ,
+		killKey: DefaultKillSwitch,
+	}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return nil
+	}
+	o.set = set
+	for _, p := range o.prefixWhen {
+		if p.detect() {
+			o.prefix = p.prefix
+			o.prefixes = nil
+			break
+		}
+	}
+	res, _ := DryRun(append(options[:len(options):len(options)], FlagSet(set))...)
+	if res == nil {
+		return nil
+	}
+	disabled := o.disabled()
+	var exps []FlagExplanation
+	set.VisitAll(func(f *flag.Flag) {
+		exp := FlagExplanation{Name: f.Name, Source: res.Sources[f.Name], Key: res.Keys[f.Name]}
+		if !disabled && !o.argsOnly[f.Name] && o.filtered(f) {
+			for _, key := range o.keys(f.Name) {
+				v, ok := o.lookup(key)
+				exp.Keys = append(exp.Keys, KeyStatus{Key: key, Present: o.defined(f.Name, v, ok)})
+			}
+		}
+		exps = append(exps, exp)
+	})
+	return exps
+}
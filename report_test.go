@@ -0,0 +1,248 @@
+package envflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProvenanceFile(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_HOST=example.com", "APP_TOKEN=secret"})
+	dir := t.TempDir()
+	parse := func(path string, format Format) []byte {
+		set := flag.NewFlagSet("provenance", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.String("host", "", "")
+		set.String("token", "", "")
+		set.Int("port", 80, "")
+		set.Bool("v", false, "")
+		err := Parse(FlagSet(set), Args([]string{"-v"}), Prefix("APP_"), Redact("token"), ProvenanceFile(path, format))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	got := string(parse(filepath.Join(dir, "provenance.txt"), FormatText))
+	want := `flag=host value="example.com" source=env key=APP_HOST
+flag=port value="80" source=default
+flag=token value="[redacted]" source=env key=APP_TOKEN
+flag=v value="true" source=arg
+`
+	if got != want {
+		t.Errorf("text: want:\n%s\ngot:\n%s", want, got)
+	}
+
+	var records []provenance
+	if err := json.Unmarshal(parse(filepath.Join(dir, "provenance.json"), FormatJSON), &records); err != nil {
+		t.Fatal(err)
+	}
+	wantRecords := []provenance{
+		{Flag: "host", Value: "example.com", Source: "env", Key: "APP_HOST"},
+		{Flag: "port", Value: "80", Source: "default"},
+		{Flag: "token", Value: "[redacted]", Source: "env", Key: "APP_TOKEN"},
+		{Flag: "v", Value: "true", Source: "arg"},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("json: want: %v; got: %v", wantRecords, records)
+	}
+
+	path := filepath.Join(dir, "provenance.txt")
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("mode: want: %v; got: %v", os.FileMode(0600), perm)
+	}
+	set := flag.NewFlagSet("provenance", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("host", "", "")
+	set.String("user", "", "")
+	err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), Required("user"), ProvenanceFile(path, FormatText))
+	if err == nil {
+		t.Fatal("want error for missing required flag")
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != want {
+		t.Errorf("failed Parse rewrote provenance: %q, %v", b, err)
+	}
+}
+
+func TestMetricsText(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=8080", "TOKEN=secret", "PIN=1234"})
+	set := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	set.Int("port", 0, "")
+	set.String("token", "", "")
+	set.Int("pin", 0, "")
+	set.Bool("v", false, "")
+	set.Duration("timeout", 1500*time.Millisecond, "")
+	set.String("name", "a \"b\"", "")
+	var buf bytes.Buffer
+	if err := Parse(FlagSet(set), Args([]string{"-v"}), Redact("token", "pin"), MetricsText(&buf)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `# TYPE envflag_flag_value gauge
+# HELP envflag_flag_value Value of a numeric flag.
+envflag_flag_value{name="port",source="env"} 8080
+envflag_flag_value{name="timeout",source="default"} 1.5
+envflag_flag_value{name="v",source="arg"} 1
+# TYPE envflag_flag info
+# HELP envflag_flag Value of a flag.
+envflag_flag_info{name="name",source="default",value="a \"b\""} 1
+envflag_flag_info{name="pin",source="env"} 1
+envflag_flag_info{name="token",source="env"} 1
+# EOF
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_HOST=example.com", "APP_TOKEN=secret"})
+	set := flag.NewFlagSet("slog", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("host", "", "")
+	set.String("token", "", "")
+	set.Int("port", 80, "")
+	set.Bool("v", false, "")
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	err := Parse(FlagSet(set), Args([]string{"-v"}), Prefix("APP_"), Redact("token"), SlogHandler(logger))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `level=DEBUG msg="envflag: resolved flag" flag=host value=example.com source=env key=APP_HOST
+level=DEBUG msg="envflag: resolved flag" flag=port value=80 source=default
+level=DEBUG msg="envflag: resolved flag" flag=token value=[redacted] source=env key=APP_TOKEN
+level=DEBUG msg="envflag: resolved flag" flag=v value=true source=arg
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWriteEnv(t *testing.T) {
+	set := flag.NewFlagSet("write_env", flag.ContinueOnError)
+	set.String("log.level", "debug", "")
+	set.String("greeting", "it's me", "")
+	set.String("empty", "", "")
+	set.Int("port", 80, "")
+	set.String("token", "secret", "")
+	var buf bytes.Buffer
+	err := WriteEnv(&buf, FlagSet(set), Prefix("APP_"), Redact("token"), KeyChain("port", "/PORT"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "APP_EMPTY=''\nAPP_GREETING='it'\\''s me'\nAPP_LOG_LEVEL=debug\nPORT=80\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
+
+func TestWriteEnvReadOnce(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_TOKEN=once", "APP_PORT=80"})
+	set := flag.NewFlagSet("write_env", flag.ContinueOnError)
+	set.String("token", "", "")
+	set.Int("port", 0, "")
+	if err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), ReadOnce("token")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteEnv(&buf, FlagSet(set), Prefix("APP_")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := "APP_PORT=80\n", buf.String(); got != want {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+	if v := set.Lookup("token").Value.String(); v != "once" {
+		t.Errorf("token after WriteEnv: want: %q; got: %q", "once", v)
+	}
+}
+
+func TestOnComplete(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_PORT=80", "APP_HOST=env", "APP_NAME=env"})
+	set := flag.NewFlagSet("on_complete", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("port", 0, "")
+	set.String("host", "", "")
+	set.String("name", "", "")
+	set.String("user", "", "")
+	set.Bool("v", false, "")
+	var calls []Stats
+	fn := func(s Stats) { calls = append(calls, s) }
+	err := Parse(FlagSet(set), Prefix("APP_"), Args([]string{"-name=arg", "-v"}), Required("port", "name", "port", "undefined"), OnComplete(fn), OnComplete(fn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("calls: want: 2; got: %d", len(calls))
+	}
+	s := calls[0]
+	if want := map[Source]int{SourceEnv: 2, SourceArg: 2, SourceDefault: 1}; !reflect.DeepEqual(s.Sources, want) {
+		t.Errorf("sources: want: %v; got: %v", want, s.Sources)
+	}
+	if want := []string{"APP_HOST", "APP_PORT"}; !reflect.DeepEqual(s.Keys, want) {
+		t.Errorf("keys: want: %q; got: %q", want, s.Keys)
+	}
+	if s.Required != 2 || s.Duration <= 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	calls = nil
+	if err := Parse(FlagSet(set), Args(nil), Required("user"), OnComplete(fn)); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(calls) != 0 {
+		t.Errorf("calls: want: 0; got: %d", len(calls))
+	}
+}
+
+func TestExplain(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_PORT=8080", "LEGACY_HOST=old", "APP_TOKEN=secret"})
+	set := flag.NewFlagSet("explain", flag.ContinueOnError)
+	set.SetOutput(&bytes.Buffer{})
+	set.Int("port", 0, "")
+	host := set.String("host", "default", "")
+	set.String("token", "", "")
+	set.Bool("wipe", false, "")
+	opts := []Option{Prefix("APP"), Args([]string{"-token=arg"}), Aliases(map[string][]string{"host": {"LEGACY_HOST"}}), ArgsOnly("wipe")}
+	got := Explain(set, opts...)
+	want := []FlagExplanation{
+		{Name: "host", Keys: []KeyStatus{{"LEGACY_HOST", true}, {"APP_HOST", false}}, Source: SourceEnv, Key: "LEGACY_HOST"},
+		{Name: "port", Keys: []KeyStatus{{"APP_PORT", true}}, Source: SourceEnv, Key: "APP_PORT"},
+		{Name: "token", Keys: []KeyStatus{{"APP_TOKEN", true}}, Source: SourceArg},
+		{Name: "wipe", Source: SourceDefault},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v; got: %+v", want, got)
+	}
+	if *host != "default" {
+		t.Errorf("host: want: %q; got: %q", "default", *host)
+	}
+	if got := Explain(set, BoolValues([]string{"on"}, []string{"on"})); got != nil {
+		t.Errorf("invalid options: want: nil; got: %+v", got)
+	}
+}
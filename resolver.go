@@ -0,0 +1,64 @@
+package envflag
+
+import (
+	"context"
+	"sync"
+)
+
+// A Resolver parses flags like Parse, but caches the environment variable
+// keys derived from flag names, so that repeated parses of the same flags,
+// such as in a configuration reload loop, don't derive them again. Cached
+// keys are specific to the options which affect key derivation, such as
+// Prefix and AcronymAware, so changing those options between parses does
+// not use stale keys. Keys derived by a NameMapper are not cached, since
+// the mapper may not be pure. A Resolver is safe for concurrent use by multiple
+// goroutines.
+type Resolver struct {
+	mu   sync.RWMutex
+	keys map[keyConfig]string
+}
+
+// keyConfig identifies a flag name and the options used to derive its key.
+type keyConfig struct {
+	name         string
+	prefix       string
+	acronyms     bool
+	preserveCase bool
+	exactCase    bool
+	separator    string
+}
+
+// NewResolver returns a new Resolver with an empty key cache.
+func NewResolver() *Resolver {
+	return &Resolver{keys: make(map[keyConfig]string)}
+}
+
+// Parse is like the package-level Parse, but uses the Resolver's key cache.
+func (r *Resolver) Parse(options ...Option) error {
+	return r.ParseContext(context.Background(), options...)
+}
+
+// ParseContext is like the package-level ParseContext, but uses the
+// Resolver's key cache.
+func (r *Resolver) ParseContext(ctx context.Context, options ...Option) error {
+	_, err := parseContext(ctx, r, options)
+	return err
+}
+
+func (r *Resolver) key(o *option, prefix, name string) string {
+	c := keyConfig{name: name, prefix: prefix, acronyms: o.acronyms, preserveCase: o.preserveCase, exactCase: o.exactCase, separator: "_"}
+	if o.separator != nil {
+		c.separator = *o.separator
+	}
+	r.mu.RLock()
+	key, ok := r.keys[c]
+	r.mu.RUnlock()
+	if ok {
+		return key
+	}
+	key = o.deriveKey(prefix, name)
+	r.mu.Lock()
+	r.keys[c] = key
+	r.mu.Unlock()
+	return key
+}
@@ -0,0 +1,66 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A_API_KEY=a", "B_API_KEY=b", "B_APIKEY=c"})
+	r := NewResolver()
+	for _, tt := range []struct {
+		opts []Option
+		want string
+	}{
+		{opts: []Option{Prefix("A_"), AcronymAware()}, want: "a"},
+		{opts: []Option{Prefix("B_"), AcronymAware()}, want: "b"},
+		{opts: []Option{Prefix("B_")}, want: "c"},
+		{opts: []Option{Prefix("A_"), AcronymAware()}, want: "a"},
+	} {
+		set := flag.NewFlagSet("resolver", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		v := set.String("apiKey", "", "")
+		if err := r.Parse(append(tt.opts, FlagSet(set), Args(nil))...); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *v != tt.want {
+			t.Errorf("want: %q; got: %q", tt.want, *v)
+		}
+	}
+	if n := len(r.keys); n != 3 {
+		t.Errorf("cached keys: want: 3; got: %d", n)
+	}
+}
+
+func BenchmarkResolver(b *testing.B) {
+	defer resetEnv()()
+	set := flag.NewFlagSet("resolver", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	var env []string
+	for i := 0; i < 1000; i++ {
+		set.String(fmt.Sprintf("serviceName%dHTTPTimeout", i), "", "")
+		if i%10 == 0 {
+			env = append(env, fmt.Sprintf("APP_SERVICE_NAME%d_HTTP_TIMEOUT=value", i))
+		}
+	}
+	setEnv(env)
+	opts := []Option{FlagSet(set), Args(nil), Prefix("APP_"), AcronymAware()}
+	b.Run("uncached", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if err := Parse(opts...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		r := NewResolver()
+		for n := 0; n < b.N; n++ {
+			if err := r.Parse(opts...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package envflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONSchema returns an Option which causes Parse to fail if the resolved
+// flags, as a JSON object keyed by flag name, do not conform to the given JSON
+// Schema. Bool and numeric flags are represented by JSON booleans and numbers,
+// and all other flags, including durations, by strings. Each violation is
+// reported, naming the flag where the schema path identifies one.
+//
+// To avoid dependencies, the schema is validated internally, supporting the
+// keywords type, enum, const, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, multipleOf, minLength, maxLength, pattern, properties,
+// required, additionalProperties, allOf, anyOf, oneOf, and not. Other
+// keywords are ignored. Parse fails if the schema is not valid JSON.
+func JSONSchema(schema []byte) Option {
+	return func(o *option) {
+		var s interface{}
+		d := json.NewDecoder(bytes.NewReader(schema))
+		d.UseNumber()
+		if err := d.Decode(&s); err != nil {
+			if o.err == nil {
+				o.err = fmt.Errorf("envflag: invalid JSON schema: %v", err)
+			}
+			return
+		}
+		o.schemas = append(o.schemas, s)
+	}
+}
+
+func (o *option) checkSchemas() []error {
+	if len(o.schemas) == 0 {
+		return nil
+	}
+	doc := make(map[string]interface{})
+	o.set.VisitAll(func(f *flag.Flag) { doc[f.Name] = jsonValue(f.Value) })
+	var errs []error
+	for _, s := range o.schemas {
+		for _, v := range validateSchema(s, doc, "") {
+			if name := strings.SplitN(strings.TrimPrefix(v.path, "/"), "/", 2)[0]; o.set.Lookup(name) != nil {
+				errs = append(errs, fmt.Errorf("envflag: flag -%s: %s", name, v.msg))
+			} else {
+				errs = append(errs, fmt.Errorf("envflag: schema: %s: %s", v.path, v.msg))
+			}
+		}
+	}
+	return errs
+}
+
+// jsonValue returns the representation of a flag value in a JSON object.
+func jsonValue(v flag.Value) interface{} {
+	if g, ok := v.(flag.Getter); ok {
+		switch x := g.Get().(type) {
+		case bool:
+			return x
+		case time.Duration:
+			return x.String()
+		case int, int64, uint, uint64, float64:
+			return json.Number(fmt.Sprint(x))
+		}
+	}
+	return v.String()
+}
+
+type violation struct {
+	path string
+	msg  string
+}
+
+func validateSchema(schema, v interface{}, path string) []violation {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		if b, ok := schema.(bool); ok && !b {
+			return []violation{{path, "is not allowed"}}
+		}
+		return nil
+	}
+	var vs []violation
+	fail := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		vs = append(vs, violation{p, fmt.Sprintf(format, args...)})
+	}
+	if t, ok := s["type"]; ok && !matchesType(t, v) {
+		fail("must be of type %v", t)
+		return vs
+	}
+	if e, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, x := range e {
+			found = found || jsonEqual(x, v)
+		}
+		if !found {
+			fail("must be one of %v", e)
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		fail("must be %v", c)
+	}
+	if n, ok := number(v); ok {
+		if m, ok := number(s["minimum"]); ok && n < m {
+			fail("must be >= %v", m)
+		}
+		if m, ok := number(s["maximum"]); ok && n > m {
+			fail("must be <= %v", m)
+		}
+		if m, ok := number(s["exclusiveMinimum"]); ok && n <= m {
+			fail("must be > %v", m)
+		}
+		if m, ok := number(s["exclusiveMaximum"]); ok && n >= m {
+			fail("must be < %v", m)
+		}
+		if m, ok := number(s["multipleOf"]); ok && m != 0 && math.Mod(n, m) != 0 {
+			fail("must be a multiple of %v", m)
+		}
+	}
+	if str, ok := v.(string); ok {
+		if m, ok := number(s["minLength"]); ok && float64(utf8.RuneCountInString(str)) < m {
+			fail("must be at least %v characters", m)
+		}
+		if m, ok := number(s["maxLength"]); ok && float64(utf8.RuneCountInString(str)) > m {
+			fail("must be at most %v characters", m)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err != nil {
+				fail("invalid pattern %q: %v", p, err)
+			} else if !re.MatchString(str) {
+				fail("must match pattern %q", p)
+			}
+		}
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		props, _ := s["properties"].(map[string]interface{})
+		if req, ok := s["required"].([]interface{}); ok {
+			for _, r := range req {
+				if name, ok := r.(string); ok {
+					if _, ok := obj[name]; !ok {
+						vs = append(vs, violation{path + "/" + name, "is required"})
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k]; ok {
+				vs = append(vs, validateSchema(ps, obj[k], path+"/"+k)...)
+			} else if ap, ok := s["additionalProperties"]; ok {
+				vs = append(vs, validateSchema(ap, obj[k], path+"/"+k)...)
+			}
+		}
+	}
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			vs = append(vs, validateSchema(sub, v, path)...)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		n := 0
+		for _, sub := range anyOf {
+			if len(validateSchema(sub, v, path)) == 0 {
+				n++
+			}
+		}
+		if n == 0 {
+			fail("must match at least one schema of anyOf")
+		}
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		n := 0
+		for _, sub := range one {
+			if len(validateSchema(sub, v, path)) == 0 {
+				n++
+			}
+		}
+		if n != 1 {
+			fail("must match exactly one schema of oneOf, but matches %d", n)
+		}
+	}
+	if not, ok := s["not"]; ok && len(validateSchema(not, v, path)) == 0 {
+		fail("must not match schema")
+	}
+	return vs
+}
+
+func matchesType(t, v interface{}) bool {
+	if ts, ok := t.([]interface{}); ok {
+		for _, t := range ts {
+			if matchesType(t, v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "integer":
+		n, ok := number(v)
+		return ok && n == math.Trunc(n)
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,94 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"level": {"enum": ["debug", "info", "warn", "error"]},
+		"host": {"type": "string", "pattern": "^[a-z.]+$"},
+		"tls": {"type": "boolean"},
+		"timeout": {"type": "string"}
+	},
+	"required": ["port", "level"]
+}`
+
+func TestJSONSchema(t *testing.T) {
+	defer resetEnv()()
+	tests := []struct {
+		env      []string
+		wantErrs []string
+	}{
+		{env: []string{"PORT=8080", "LEVEL=info", "HOST=example.com", "TLS=yes"}},
+		{
+			env: []string{"PORT=0", "LEVEL=verbose", "HOST=Example.com"},
+			wantErrs: []string{
+				"envflag: flag -host: must match pattern",
+				"envflag: flag -level: must be one of [debug info warn error]",
+				"envflag: flag -port: must be >= 1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		resetEnv()
+		setEnv(tt.env)
+		set := flag.NewFlagSet("schema", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.Int("port", 0, "")
+		set.String("level", "", "")
+		set.String("host", "", "")
+		set.Bool("tls", false, "")
+		set.Duration("timeout", time.Second, "")
+		err := Parse(FlagSet(set), Args(nil), JSONSchema([]byte(testSchema)))
+		if len(tt.wantErrs) == 0 {
+			if err != nil {
+				t.Errorf("env=%v: unexpected error: %v", tt.env, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("env=%v: expected error", tt.env)
+			continue
+		}
+		for _, want := range tt.wantErrs {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("env=%v: error: want: %q; got: %q", tt.env, want, err)
+			}
+		}
+	}
+
+	set := flag.NewFlagSet("schema", flag.ContinueOnError)
+	if err := Parse(FlagSet(set), Args(nil), JSONSchema([]byte("{"))); err == nil {
+		t.Error("invalid schema: expected error")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "boolean"},
+		},
+		"not": map[string]interface{}{"const": "forbidden"},
+	}
+	for _, tt := range []struct {
+		v    interface{}
+		want int
+	}{
+		{"ok", 0},
+		{true, 0},
+		{"forbidden", 1},
+		{nil, 1},
+	} {
+		if got := len(validateSchema(schema, tt.v, "")); got != tt.want {
+			t.Errorf("%v: want %d violations; got %d", tt.v, tt.want, got)
+		}
+	}
+}
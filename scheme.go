@@ -0,0 +1,50 @@
+package envflag
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SchemeResolver returns an Option which resolves environment variable values
+// which are URLs with the given scheme by calling fn, such as to read a secret
+// from a vault given DB_PASSWORD=vault://secret/db#password, and passes the
+// value it returns to the flag's Set method in place of the URL. The context
+// is that given to ParseContext, or context.Background. Schemes are matched
+// case-insensitively, and values with other schemes, or which aren't URLs,
+// are used literally. The URL is resolved after whitespace is trimmed and
+// before values are decoded by a Codec. If fn fails, Parse fails with an error
+// naming the flag, key, and scheme, but not the URL. Flags holding secrets
+// should also be named by Redact, so that their values are omitted from other
+// errors and output.
+func SchemeResolver(scheme string, fn func(ctx context.Context, u *url.URL) (string, error)) Option {
+	return func(o *option) {
+		if o.schemes == nil {
+			o.schemes = make(map[string]func(context.Context, *url.URL) (string, error))
+		}
+		o.schemes[strings.ToLower(scheme)] = fn
+	}
+}
+
+// resolveScheme returns the value resolved from s by a SchemeResolver, if s is
+// a URL with a registered scheme, or s itself otherwise.
+func (o *option) resolveScheme(s string) (string, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return s, nil
+	}
+	fn, ok := o.schemes[strings.ToLower(s[:i])]
+	if !ok {
+		return s, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return s, nil
+	}
+	v, err := fn(o.ctx, u)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s URL: %v", u.Scheme, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,60 @@
+package envflag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"net/url"
+	"testing"
+)
+
+func TestSchemeResolver(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{
+		"PASSWORD=vault://secret/db#password",
+		"UPPER=VAULT://secret/api#token",
+		"LINK=https://example.com",
+		"PLAIN=hunter2",
+		"PORT=port:8080",
+	})
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "tenant")
+	vault := func(ctx context.Context, u *url.URL) (string, error) {
+		return ctx.Value(ctxKey{}).(string) + ":" + u.Host + u.Path + ":" + u.Fragment, nil
+	}
+	port := func(ctx context.Context, u *url.URL) (string, error) { return u.Opaque, nil }
+	set := flag.NewFlagSet("scheme", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	password := set.String("password", "", "")
+	upper := set.String("upper", "", "")
+	link := set.String("link", "", "")
+	plain := set.String("plain", "", "")
+	portNum := set.Int("port", 0, "")
+	err := ParseContext(ctx, FlagSet(set), Args(nil), SchemeResolver("vault", vault), SchemeResolver("PORT", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct{ got, want string }{
+		{*password, "tenant:secret/db:password"},
+		{*upper, "tenant:secret/api:token"},
+		{*link, "https://example.com"},
+		{*plain, "hunter2"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("want: %q; got: %q", tt.want, tt.got)
+		}
+	}
+	if *portNum != 8080 {
+		t.Errorf("port: want: 8080; got: %d", *portNum)
+	}
+
+	fail := func(ctx context.Context, u *url.URL) (string, error) { return "", errors.New("sealed") }
+	set = flag.NewFlagSet("scheme", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("password", "", "")
+	err = Parse(FlagSet(set), Args(nil), SchemeResolver("vault", fail))
+	if want := "envflag: flag -password: PASSWORD: resolving vault URL: sealed"; err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+}
@@ -0,0 +1,144 @@
+package envflag
+
+import (
+	"flag"
+	"strings"
+	"sync"
+)
+
+const masked = "****"
+
+// A Secret is a flag.Value holding a sensitive string, such as a password or
+// an API token. Its String method returns "****" if the value is non-empty,
+// so the value isn't leaked by usage messages, error messages, or anything
+// else that formats flags, and Secret flags are always redacted from reports
+// such as ProvenanceFile and SlogHandler, as if marked by Redact. Use Reveal
+// to access the value.
+//
+// Since its String method doesn't return its value, a Secret flag is excluded
+// from ReloadDiff and Watch.
+type Secret struct {
+	value string
+}
+
+// SecretVar defines a Secret flag with the specified name and usage string
+// in set and returns it. The flag is resolved from the environment by Parse
+// like any other flag.
+func SecretVar(set *flag.FlagSet, name, usage string) *Secret {
+	s := new(Secret)
+	set.Var(s, name, usage)
+	return s
+}
+
+// Reveal returns the value of the secret.
+func (s *Secret) Reveal() string {
+	return s.value
+}
+
+// Set sets the value of the secret.
+func (s *Secret) Set(value string) error {
+	s.value = value
+	return nil
+}
+
+// String returns "****", or the empty string if the secret is empty.
+func (s *Secret) String() string {
+	if s == nil || s.value == "" {
+		return ""
+	}
+	return masked
+}
+
+// sensitive reports whether the flag's value must be redacted.
+func (o *option) sensitive(f *flag.Flag) bool {
+	_, ok := f.Value.(*Secret)
+	return ok || o.redact[f.Name]
+}
+
+// redactString returns s with any occurrences of v, a value of the named flag,
+// replaced by "[redacted]", if the flag is sensitive.
+func (o *option) redactString(name, s, v string) string {
+	f := o.set.Lookup(name)
+	if v == "" || f == nil || !o.sensitive(f) {
+		return s
+	}
+	return strings.Replace(s, v, redacted, -1)
+}
+
+// rawString returns the value of v as its String method would, but revealing
+// secrets, so that it can be restored by its Set method.
+func rawString(v flag.Value) string {
+	switch x := v.(type) {
+	case *Secret:
+		return x.Reveal()
+	case *readOnce:
+		return rawString(x.Value)
+	}
+	return v.String()
+}
+
+// ReadOnce returns an Option which, after a successful Parse, makes the values
+// of the named flags readable only once, such as for a one-time token. The
+// first call to the String or Get method of such a flag's Value returns its
+// value and every subsequent call returns the empty string or nil. The value
+// must be read through the flag's Value, as returned by the FlagSet's Lookup
+// method, since variables bound to the flag are not guarded.
+//
+// The guard is safe for concurrent use: if multiple goroutines read the value
+// concurrently, exactly one of them observes it. Anything that formats the
+// flag after Parse returns, such as the FlagSet's PrintDefaults method or
+// ReloadDiff, also consumes the read.
+func ReadOnce(names ...string) Option {
+	return func(o *option) {
+		o.readOnce = append(o.readOnce, names...)
+	}
+}
+
+type readOnce struct {
+	flag.Value
+	mu   sync.Mutex
+	read bool
+}
+
+// consume reports whether this is the first read of the value.
+func (v *readOnce) consume() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	first := !v.read && v.Value != nil
+	v.read = true
+	return first
+}
+
+func (v *readOnce) String() string {
+	if !v.consume() {
+		return ""
+	}
+	return v.Value.String()
+}
+
+func (v *readOnce) Get() interface{} {
+	if !v.consume() {
+		return nil
+	}
+	if g, ok := v.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return v.Value.String()
+}
+
+func (v *readOnce) IsBoolFlag() bool {
+	return isBoolFlag(v.Value)
+}
+
+// guardReads wraps the values of the flags given to ReadOnce.
+func (o *option) guardReads() {
+	for _, name := range o.readOnce {
+		f := o.set.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if _, ok := f.Value.(*readOnce); !ok {
+			f.Value = &readOnce{Value: f.Value}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"TOKEN={{ .Token }}", "PASSWORD=hunter2"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "provenance.txt")
+	set := flag.NewFlagSet("secret", flag.ContinueOnError)
+	var out bytes.Buffer
+	set.SetOutput(&out)
+	token := SecretVar(set, "token", "API token")
+	password := SecretVar(set, "password", "password")
+	empty := SecretVar(set, "empty", "unset secret")
+	err := Parse(FlagSet(set), Args(nil), WarnPlaceholders(), ProvenanceFile(path, FormatText))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := token.Reveal(); got != "{{ .Token }}" {
+		t.Errorf("token: want: %q; got: %q", "{{ .Token }}", got)
+	}
+	if got := password.Reveal(); got != "hunter2" {
+		t.Errorf("password: want: %q; got: %q", "hunter2", got)
+	}
+	if got := password.String(); got != "****" {
+		t.Errorf("password string: want: %q; got: %q", "****", got)
+	}
+	if got := empty.String(); got != "" {
+		t.Errorf("empty string: want: %q; got: %q", "", got)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.PrintDefaults()
+	for _, s := range []string{string(b), out.String()} {
+		if strings.Contains(s, "hunter2") || strings.Contains(s, "Token") {
+			t.Errorf("secret leaked:\n%s", s)
+		}
+	}
+	if !strings.Contains(string(b), `flag=password value="[redacted]" source=env key=PASSWORD`) {
+		t.Errorf("provenance: password not redacted:\n%s", b)
+	}
+}
+
+func TestSecretAtomic(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PASSWORD=new", "N=x"})
+	set := flag.NewFlagSet("secret_atomic", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	password := SecretVar(set, "password", "")
+	password.Set("old")
+	set.Int("n", 0, "")
+	if err := Parse(FlagSet(set), Args(nil), Atomic()); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := password.Reveal(); got != "old" {
+		t.Errorf("want: %q; got: %q", "old", got)
+	}
+}
+
+func TestReadOnce(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"TOKEN=abc", "N=42"})
+	set := flag.NewFlagSet("read_once", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("token", "", "")
+	set.Int("n", 0, "")
+	set.Bool("v", false, "")
+	if err := Parse(FlagSet(set), Args([]string{"-v"}), ReadOnce("token", "n", "v")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := set.Lookup("token").Value.String(); got != "abc" {
+		t.Errorf("token: first read: want: %q; got: %q", "abc", got)
+	}
+	if got := set.Lookup("token").Value.String(); got != "" {
+		t.Errorf("token: second read: want: %q; got: %q", "", got)
+	}
+	n := set.Lookup("n").Value.(flag.Getter)
+	if got := n.Get(); got != 42 {
+		t.Errorf("n: first read: want: 42; got: %v", got)
+	}
+	if got := n.Get(); got != nil {
+		t.Errorf("n: second read: want: nil; got: %v", got)
+	}
+	if !isBoolFlag(set.Lookup("v").Value) {
+		t.Error("v: want bool flag")
+	}
+
+	set = flag.NewFlagSet("read_once_concurrent", flag.ContinueOnError)
+	set.String("token", "", "")
+	if err := Parse(FlagSet(set), Args(nil), ReadOnce("token")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var reads []string
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v := set.Lookup("token").Value.String(); v != "" {
+				mu.Lock()
+				reads = append(reads, v)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(reads) != 1 || reads[0] != "abc" {
+		t.Errorf("concurrent reads: want: [abc]; got: %q", reads)
+	}
+}
+
+func TestRedactErrors(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"TTL=hunter2", "PIN=007", "CODE=xyzzy"})
+	newSet := func(out *bytes.Buffer) *flag.FlagSet {
+		set := flag.NewFlagSet("redact", flag.ContinueOnError)
+		set.SetOutput(out)
+		set.Duration("ttl", 0, "token TTL")
+		set.Int("pin", 0, "")
+		set.String("key", "s3cret", "signing key")
+		set.Func("code", "", func(s string) error { return fmt.Errorf("bad code %s", s) })
+		return set
+	}
+
+	var out bytes.Buffer
+	err := Parse(FlagSet(newSet(&out)), Args(nil), Redact("ttl", "pin", "key", "code"), AllErrors(), RejectLeadingZeros("pin"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`envflag: invalid value [redacted] for flag -ttl from TTL: parse error`,
+		`envflag: flag -pin: PIN: leading zero in value [redacted]`,
+		`envflag: invalid value [redacted] for flag -code from CODE: bad code [redacted]`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error: want: %q; got: %q", want, err)
+		}
+	}
+
+	out.Reset()
+	err = Parse(FlagSet(newSet(&out)), Args([]string{"-key=k", "-ttl=hunter2"}), Redact("ttl", "key"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got := err.Error() + out.String(); strings.Contains(got, "hunter2") || strings.Contains(got, "s3cret") {
+		t.Errorf("value leaked: %q; output: %q", err, out.String())
+	}
+	if want := `invalid value "[redacted]" for flag -ttl`; !strings.Contains(out.String(), want) || !strings.Contains(err.Error(), want) {
+		t.Errorf("error: want: %q; got: %q; output: %q", want, err, out.String())
+	}
+	if want := `signing key (default "[redacted]")`; !strings.Contains(out.String(), want) {
+		t.Errorf("usage: want: %q; got: %q", want, out.String())
+	}
+}
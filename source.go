@@ -0,0 +1,312 @@
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Source identifies where a flag's value came from.
+type Source int
+
+// Sources of flag values.
+const (
+	SourceDefault  Source = iota // the flag's default value
+	SourceArg                    // the argument list
+	SourceEnv                    // the environment
+	SourceProvider               // a Provider given to TypedSource
+	SourceLookup                 // a LookupFunc given to LookupSource
+	SourceFile                   // a file given to EnvFile or EnvReader
+	SourceDefaults               // a map given to Defaults
+	SourceJSON                   // a file given to JSONFile
+	SourceConfig                 // a file given to ConfigFile
+)
+
+var sourceNames = [...]string{
+	SourceDefault:  "default",
+	SourceArg:      "arg",
+	SourceEnv:      "env",
+	SourceProvider: "provider",
+	SourceLookup:   "lookup",
+	SourceFile:     "file",
+	SourceDefaults: "defaults",
+	SourceJSON:     "json",
+	SourceConfig:   "config",
+}
+
+func (s Source) String() string {
+	if s >= 0 && int(s) < len(sourceNames) {
+		return sourceNames[s]
+	}
+	return fmt.Sprintf("Source(%d)", int(s))
+}
+
+// RequireSource returns an Option which causes Parse to fail if the value
+// of the named flag did not come from the given source. This may be used to
+// enforce a policy that, for example, a flag is only set by the environment.
+func RequireSource(name string, source Source) Option {
+	return func(o *option) {
+		if o.requireSource == nil {
+			o.requireSource = make(map[string]Source)
+		}
+		o.requireSource[name] = source
+	}
+}
+
+func (o *option) checkSources() []error {
+	var errs []error
+	for _, name := range sortedKeys(o.requireSource) {
+		if o.set.Lookup(name) == nil {
+			continue
+		}
+		if want, got := o.requireSource[name], o.sources[name]; got != want {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s must be set from %v, but was set from %v", name, want, got))
+		}
+	}
+	return errs
+}
+
+// EnvOnly returns an Option which causes Parse to fail, before setting any
+// flags, if one of the named flags is given in the argument list, so that
+// flags holding secrets cannot be exposed by the argument list, which is
+// visible to other users of the system, such as in the output of ps. The
+// flags are still read from the environment and other sources.
+func EnvOnly(names ...string) Option {
+	return func(o *option) {
+		if o.envOnly == nil {
+			o.envOnly = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.envOnly[name] = true
+		}
+	}
+}
+
+func (o *option) checkEnvOnly() error {
+	if o.envOnly == nil {
+		return nil
+	}
+	var names []string
+	for _, name := range sortedKeys(scanArgs(o.set, o.args)) {
+		if o.envOnly[name] {
+			names = append(names, "-"+name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("envflag: flags may not be set by the argument list: %s", strings.Join(names, ", "))
+}
+
+// DetectConflicts returns an Option which causes Parse to fail if a flag is
+// given in the argument list and also set in the environment, but with a
+// different value, rather than silently preferring one of them. The error
+// names the flag and both values, unless it's sensitive. The environment's
+// value is compared as Parse would use it, such as after TrimSpace or a Codec,
+// and those of bool flags are normalized first, so that "-v" and V=yes agree.
+// Flags which Parse doesn't read from the environment, such as those named by
+// ArgsOnly, are never in conflict.
+func DetectConflicts() Option {
+	return func(o *option) {
+		o.detectConflicts = true
+	}
+}
+
+func (o *option) checkConflicts() []error {
+	if !o.detectConflicts || o.disabled() {
+		return nil
+	}
+	var errs []error
+	args := scanArgs(o.set, o.args)
+	for _, name := range sortedKeys(args) {
+		f := o.set.Lookup(name)
+		if o.argsOnly[name] || !o.filtered(f) {
+			continue
+		}
+		key, ev, ok := o.envLookup(name)
+		if !ok {
+			continue
+		}
+		// Compare the value Parse would use; an invalid one is reported
+		// when it's resolved.
+		ev, err := o.envValue(name, key, ev)
+		if err != nil {
+			continue
+		}
+		av := args[name]
+		if o.normalizeBool(f) {
+			av, _ = o.boolValue(av)
+			ev, _ = o.boolValue(ev)
+		}
+		if av == ev {
+			continue
+		}
+		if o.sensitive(f) {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: argument value conflicts with %s value", name, key))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("envflag: flag -%s: argument value %q conflicts with %s value %q", name, av, key, ev))
+	}
+	return errs
+}
+
+// ArgsOnly returns an Option which causes Parse to set the named flags only
+// from the argument list, ignoring the environment and every other source,
+// even if they have values for the flags. This is intended for dangerous
+// flags, such as one which deletes data, which must not be set inadvertently
+// by a variable shared with other programs.
+func ArgsOnly(names ...string) Option {
+	return func(o *option) {
+		if o.argsOnly == nil {
+			o.argsOnly = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.argsOnly[name] = true
+		}
+	}
+}
+
+// Filter returns an Option which causes Parse to set only the flags for which
+// keep returns true from the environment and other sources, as ArgsOnly does
+// for named flags, so that the flags of other packages registered with the
+// same FlagSet, such as flag.CommandLine, are set only from the argument list,
+// as by flag.Parse. If given more than once, a flag must satisfy every
+// predicate. Flags named by EnvOnly are still rejected in the argument list,
+// so such a flag which doesn't satisfy keep can't be set at all.
+func Filter(keep func(*flag.Flag) bool) Option {
+	return func(o *option) {
+		o.filters = append(o.filters, keep)
+	}
+}
+
+// filtered reports whether f satisfies every predicate given to Filter.
+func (o *option) filtered(f *flag.Flag) bool {
+	for _, keep := range o.filters {
+		if !keep(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultPriority is the order in which sources are consulted by default.
+var defaultPriority = []Source{SourceArg, SourceEnv, SourceFile, SourceLookup, SourceProvider, SourceJSON, SourceConfig, SourceDefaults}
+
+// FlagPriority returns an Option which specifies the order in which sources
+// are consulted for the named flag, overriding the default order of the
+// argument list, the environment, files given to EnvFile, a LookupSource, a
+// TypedSource, files given to JSONFile and ConfigFile, and Defaults. The first
+// source with a value for the flag sets it. Sources omitted from order are
+// consulted after those given, in the default order, and SourceDefault is
+// ignored, since a flag keeps its default value only if no source has a value.
+//
+// For example, FlagPriority("token", SourceFile, SourceArg) prefers a value
+// from a file over one from the argument list, which in turn is preferred over
+// one from the environment. If a source preferred over the argument list has a
+// value, the flag's Set method is called again with that value, after having
+// been called for the argument, so flags that accumulate values, such as
+// lists, contain both.
+func FlagPriority(name string, order ...Source) Option {
+	return func(o *option) {
+		if o.priorities == nil {
+			o.priorities = make(map[string][]Source)
+		}
+		var p []Source
+		seen := map[Source]bool{SourceDefault: true}
+		for _, sources := range [][]Source{order, defaultPriority} {
+			for _, src := range sources {
+				if !seen[src] {
+					seen[src] = true
+					p = append(p, src)
+				}
+			}
+		}
+		o.priorities[name] = p
+	}
+}
+
+// A PrecedenceOrder specifies whether the argument list or the environment
+// takes precedence.
+type PrecedenceOrder int
+
+// Precedence orders.
+const (
+	ArgsFirst PrecedenceOrder = iota // the argument list overrides the environment
+	EnvFirst                         // the environment overrides the argument list
+)
+
+// envFirstPriority is the order in which sources are consulted with EnvFirst.
+var envFirstPriority = []Source{SourceEnv, SourceArg, SourceFile, SourceLookup, SourceProvider, SourceJSON, SourceConfig, SourceDefaults}
+
+// Precedence returns an Option which specifies whether the argument list or
+// the environment takes precedence for all flags. If unused, it is ArgsFirst.
+// With EnvFirst, a flag given in the argument list is set again from the
+// environment, if it has a value, so that the environment is authoritative,
+// as with FlagPriority(name, SourceEnv) for every flag. Other sources remain
+// below the argument list. FlagPriority takes precedence for the flags it
+// names.
+func Precedence(order PrecedenceOrder) Option {
+	return func(o *option) {
+		o.precedence = order
+	}
+}
+
+// priority returns the order in which sources are consulted for the named flag.
+func (o *option) priority(name string) []Source {
+	if p, ok := o.priorities[name]; ok {
+		return p
+	}
+	if o.precedence == EnvFirst {
+		return envFirstPriority
+	}
+	return defaultPriority
+}
+
+// Defaults returns an Option which specifies values for flags, given by a
+// mapping from flag names to values, which are used only if no other source
+// has a value, such as baselines for an environment embedded in code, without
+// changing the flags' own default values. Values are processed like those of
+// environment variables, including bool normalization, except that they're
+// never split.
+func Defaults(m map[string]string) Option {
+	return func(o *option) {
+		if o.defaults == nil {
+			o.defaults = make(map[string]string)
+		}
+		for name, v := range m {
+			o.defaults[name] = v
+		}
+	}
+}
+
+// DefaultKillSwitch is the default key of the environment variable which
+// disables all sources other than the argument list.
+const DefaultKillSwitch = "ENVFLAG_DISABLE"
+
+// KillSwitch returns an Option which specifies the key of an environment
+// variable which, when set to a true value, such as "1" or "true", causes
+// Parse to ignore the environment and every other source, so that only the
+// argument list, which is parsed normally, sets flags, as with flag.Parse.
+// This is useful, for example, in CI jobs which must not be affected by the
+// ambient environment. The key is used verbatim, with no prefix, and is
+// DefaultKillSwitch if unused. An empty key disables the kill switch.
+func KillSwitch(key string) Option {
+	return func(o *option) {
+		o.killKey = key
+	}
+}
+
+// disabled reports whether the kill switch is set.
+func (o *option) disabled() bool {
+	if o.killKey == "" {
+		return false
+	}
+	v, ok := o.lookup(o.killKey)
+	if !ok {
+		return false
+	}
+	v, _ = o.boolValue(v)
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
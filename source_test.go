@@ -0,0 +1,322 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlagPriority(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=env", "B=env", "C=env", "D=env"})
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("A=file\nB=file\nC=file\nD=file\nE=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		desc    string
+		args    []string
+		order   []Source
+		want    string
+		wantSrc Source
+	}{
+		{desc: "default_args", args: []string{"-a=arg"}, want: "arg", wantSrc: SourceArg},
+		{desc: "default_env", want: "env", wantSrc: SourceEnv},
+		{desc: "file_args_env", args: []string{"-a=arg"}, order: []Source{SourceFile, SourceArg, SourceEnv}, want: "file", wantSrc: SourceFile},
+		{desc: "env_over_args", args: []string{"-a=arg"}, order: []Source{SourceEnv}, want: "env", wantSrc: SourceEnv},
+		{desc: "file_over_env", order: []Source{SourceFile}, want: "file", wantSrc: SourceFile},
+		{desc: "args_kept", args: []string{"-a=arg"}, order: []Source{SourceProvider, SourceArg}, want: "arg", wantSrc: SourceArg},
+		{desc: "default_ignored", order: []Source{SourceDefault, SourceFile}, want: "file", wantSrc: SourceFile},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			set := flag.NewFlagSet(tt.desc, flag.ContinueOnError)
+			set.SetOutput(bytes.NewBuffer(nil))
+			a := set.String("a", "", "")
+			b := set.String("b", "", "")
+			e := set.String("e", "", "")
+			opts := []Option{FlagSet(set), Args(append(tt.args, "-b=arg")), EnvFile(path), RequireSource("a", tt.wantSrc)}
+			if tt.order != nil {
+				opts = append(opts, FlagPriority("a", tt.order...))
+			}
+			if err := Parse(opts...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *a != tt.want {
+				t.Errorf("a: want: %q; got: %q", tt.want, *a)
+			}
+			if *b != "arg" || *e != "file" {
+				t.Errorf("unexpected values: b=%q e=%q", *b, *e)
+			}
+		})
+	}
+}
+
+func TestParseWithResult(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_HOST=example.com", "APP_PORT=x"})
+	set := flag.NewFlagSet("result", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("host", "", "")
+	set.Int("port", 80, "")
+	set.Bool("v", false, "")
+	set.String("name", "", "")
+	res, err := ParseWithResult(FlagSet(set), Args([]string{"-v", "-port=8080"}), Prefix("APP_"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantSources := map[string]Source{"host": SourceEnv, "port": SourceArg, "v": SourceArg, "name": SourceDefault}
+	if !reflect.DeepEqual(res.Sources, wantSources) {
+		t.Errorf("sources: want: %v; got: %v", wantSources, res.Sources)
+	}
+	if want := map[string]string{"host": "APP_HOST"}; !reflect.DeepEqual(res.Keys, want) {
+		t.Errorf("keys: want: %v; got: %v", want, res.Keys)
+	}
+	if want := []string{"APP_HOST", "APP_NAME"}; !reflect.DeepEqual(res.Consulted, want) {
+		t.Errorf("consulted: want: %v; got: %v", want, res.Consulted)
+	}
+	if want := []string{"port"}; !reflect.DeepEqual(res.Overridden, want) {
+		t.Errorf("overridden: want: %v; got: %v", want, res.Overridden)
+	}
+	for src, want := range map[Source]int{SourceArg: 2, SourceEnv: 1, SourceDefault: 1, SourceFile: 0} {
+		if got := res.Count(src); got != want {
+			t.Errorf("count(%v): want: %d; got: %d", src, want, got)
+		}
+	}
+
+	if res, err := ParseWithResult(FlagSet(set), Args(nil), Codec("host", "nope")); err == nil || res != nil {
+		t.Errorf("option error: want nil result and error; got: %v, %v", res, err)
+	}
+}
+
+func TestKillSwitch(t *testing.T) {
+	defer resetEnv()()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("NAME=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		env  []string
+		opts []Option
+		want string
+	}{
+		{env: []string{"PORT=1"}, want: "1"},
+		{env: []string{"PORT=1", "ENVFLAG_DISABLE=yes"}, want: "0"},
+		{env: []string{"PORT=1", "ENVFLAG_DISABLE=false"}, want: "1"},
+		{env: []string{"PORT=1", "ENVFLAG_DISABLE=1"}, opts: []Option{KillSwitch("")}, want: "1"},
+		{env: []string{"PORT=1", "NO_ENV=true"}, opts: []Option{KillSwitch("NO_ENV")}, want: "0"},
+	} {
+		os.Clearenv()
+		setEnv(tt.env)
+		set := flag.NewFlagSet("kill_switch", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		port := set.String("port", "0", "")
+		name := set.String("name", "", "")
+		v := set.Bool("v", false, "")
+		if err := Parse(append(tt.opts, FlagSet(set), Args([]string{"-v"}), EnvFile(path))...); err != nil {
+			t.Fatalf("env=%v: unexpected error: %v", tt.env, err)
+		}
+		if *port != tt.want || !*v {
+			t.Errorf("env=%v: port: want: %q; got: %q", tt.env, tt.want, *port)
+		}
+		if wantName := map[bool]string{true: "file", false: ""}[tt.want == "1"]; *name != wantName {
+			t.Errorf("env=%v: name: want: %q; got: %q", tt.env, wantName, *name)
+		}
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"HOST=env"})
+	set := flag.NewFlagSet("defaults", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	host := set.String("host", "flag", "")
+	port := set.Int("port", 80, "")
+	v := set.Bool("v", false, "")
+	debug := set.Bool("debug", false, "")
+	name := set.String("name", "flag", "")
+	res, err := ParseWithResult(FlagSet(set), Args([]string{"-port=1"}), Defaults(map[string]string{
+		"host":  "defaults",
+		"port":  "2",
+		"v":     "yes",
+		"debug": "no",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *host != "env" || *port != 1 || !*v || *debug || *name != "flag" {
+		t.Errorf("unexpected values: host=%q port=%d v=%t debug=%t name=%q", *host, *port, *v, *debug, *name)
+	}
+	want := map[string]Source{"host": SourceEnv, "port": SourceArg, "v": SourceDefaults, "debug": SourceDefaults, "name": SourceDefault}
+	if !reflect.DeepEqual(res.Sources, want) {
+		t.Errorf("sources: want: %v; got: %v", want, res.Sources)
+	}
+	if f := set.Lookup("v"); f.DefValue != "false" {
+		t.Errorf("default value changed: %q", f.DefValue)
+	}
+
+	set = flag.NewFlagSet("defaults", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Bool("v", false, "")
+	if err := Parse(FlagSet(set), Args(nil), Defaults(map[string]string{"v": "maybe"})); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEnvOnly(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"TOKEN=env"})
+	for _, tt := range []struct {
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{want: "env"},
+		{args: []string{"-v", "--", "-token=arg"}, want: "env"},
+		{args: []string{"-v", "-token", "arg"}, wantErr: "envflag: flags may not be set by the argument list: -token"},
+		{args: []string{"-key=arg", "--token=arg"}, wantErr: "envflag: flags may not be set by the argument list: -key, -token"},
+	} {
+		set := flag.NewFlagSet("env_only", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		token := set.String("token", "", "")
+		set.String("key", "", "")
+		set.Bool("v", false, "")
+		err := Parse(FlagSet(set), Args(tt.args), EnvOnly("token", "key"))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("args=%v: error: want: %q; got: %v", tt.args, tt.wantErr, err)
+			}
+			if *token != "" {
+				t.Errorf("args=%v: token set: %q", tt.args, *token)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("args=%v: unexpected error: %v", tt.args, err)
+		} else if *token != tt.want {
+			t.Errorf("args=%v: token: want: %q; got: %q", tt.args, tt.want, *token)
+		}
+	}
+}
+
+func TestArgsOnly(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"DANGER_WIPE=true", "FORCE=true", "NAME=env"})
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("FORCE=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args []string
+		want bool
+	}{
+		{want: false},
+		{args: []string{"-danger-wipe"}, want: true},
+	} {
+		set := flag.NewFlagSet("args_only", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		wipe := set.Bool("danger-wipe", false, "")
+		force := set.Bool("force", false, "")
+		name := set.String("name", "", "")
+		res, err := ParseWithResult(FlagSet(set), Args(tt.args), EnvFile(path), ArgsOnly("danger-wipe", "force"))
+		if err != nil {
+			t.Fatalf("args=%v: unexpected error: %v", tt.args, err)
+		}
+		if *wipe != tt.want || *force || *name != "env" {
+			t.Errorf("args=%v: unexpected values: danger-wipe=%t force=%t name=%q", tt.args, *wipe, *force, *name)
+		}
+		if src := res.Sources["force"]; src != SourceDefault {
+			t.Errorf("args=%v: force source: want: %v; got: %v", tt.args, SourceDefault, src)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_PORT=8080", "APP_HOST=env", "V=2", "APP_DEBUG=true"})
+	set := flag.NewFlagSet("filter", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	port := set.Int("port", 0, "")
+	host := set.String("host", "", "")
+	debug := set.Bool("debug", false, "")
+	v := set.Int("v", 0, "")
+	mine := func(f *flag.Flag) bool { return f.Name != "v" }
+	res, err := ParseWithResult(FlagSet(set), Prefix("APP"), Args([]string{"-host=arg"}),
+		Filter(mine), Filter(func(f *flag.Flag) bool { return f.Name != "debug" }), ArgsOnly("port"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *port != 0 || *host != "arg" || *debug || *v != 0 {
+		t.Errorf("unexpected values: port=%d host=%q debug=%t v=%d", *port, *host, *debug, *v)
+	}
+	for _, name := range []string{"port", "debug", "v"} {
+		if src := res.Sources[name]; src != SourceDefault {
+			t.Errorf("%s source: want: %v; got: %v", name, SourceDefault, src)
+		}
+	}
+}
+
+func TestDetectConflicts(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=80", "HOST= h ", "V=yes", "TOKEN=a"})
+	for _, tt := range []struct {
+		args    []string
+		opts    []Option
+		wantErr string
+	}{
+		{args: []string{"-port=80", "-host=h", "-v"}, opts: []Option{TrimSpace()}},
+		{args: []string{"-host=h"}, wantErr: "envflag: flag -host: argument value \"h\" conflicts with HOST value \" h \""},
+		{args: []string{"-port=8080"}, opts: []Option{ArgsOnly("port")}},
+		{args: []string{"-port=8080"}, opts: []Option{Filter(func(f *flag.Flag) bool { return f.Name != "port" })}},
+		{args: []string{"-port", "8080", "-v=false"}, wantErr: "envflag: flag -port: argument value \"8080\" conflicts with PORT value \"80\"\n" +
+			"envflag: flag -v: argument value \"false\" conflicts with V value \"true\""},
+		{args: []string{"-token=b"}, opts: []Option{Redact("token")}, wantErr: "envflag: flag -token: argument value conflicts with TOKEN value"},
+		{args: []string{"-port=8080"}, opts: []Option{KillSwitch("V")}},
+	} {
+		set := flag.NewFlagSet("conflicts", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.Int("port", 0, "")
+		set.String("host", "", "")
+		set.String("token", "", "")
+		set.Bool("v", false, "")
+		err := Parse(append(tt.opts, FlagSet(set), Args(tt.args), DetectConflicts())...)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("args=%v: unexpected error: %v", tt.args, err)
+		} else if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("args=%v: error: want: %q; got: %v", tt.args, tt.wantErr, err)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"HOST=env", "PORT=80"})
+	for _, tt := range []struct {
+		opts     []Option
+		wantHost string
+		wantSrc  Source
+	}{
+		{wantHost: "arg", wantSrc: SourceArg},
+		{opts: []Option{Precedence(ArgsFirst)}, wantHost: "arg", wantSrc: SourceArg},
+		{opts: []Option{Precedence(EnvFirst)}, wantHost: "env", wantSrc: SourceEnv},
+		{opts: []Option{Precedence(EnvFirst), FlagPriority("host", SourceArg)}, wantHost: "arg", wantSrc: SourceArg},
+	} {
+		set := flag.NewFlagSet("precedence", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		host := set.String("host", "", "")
+		port := set.Int("port", 0, "")
+		name := set.String("name", "", "")
+		res, err := ParseWithResult(append(tt.opts, FlagSet(set), Args([]string{"-host=arg", "-name=arg"}))...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *host != tt.wantHost || res.Sources["host"] != tt.wantSrc {
+			t.Errorf("host: want: %q from %v; got: %q from %v", tt.wantHost, tt.wantSrc, *host, res.Sources["host"])
+		}
+		if *port != 80 || *name != "arg" {
+			t.Errorf("unexpected values: port=%d name=%q", *port, *name)
+		}
+	}
+}
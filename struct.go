@@ -0,0 +1,232 @@
+package envflag
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct defines a flag for each exported field of the struct pointed to by v
+// and then parses them as Parse does with the given options. Each flag's
+// default value is the field's current value.
+//
+// A field's flag name is given by its `flag` tag or, by default, derived from
+// its name by separating words with dashes and lowering case, so MaxConns
+// becomes "max-conns". A field tagged `flag:"-"` is ignored. The flag's usage
+// message is given by the field's `usage` tag, and its environment variable
+// key may be given by an `env` tag, which is used verbatim, with no prefix or
+// transformation, as with Names. Fields of types
+// bool, int, int64, uint, uint64, float64, string, and time.Duration are
+// supported, as are fields whose addresses implement flag.Value or
+// encoding.TextUnmarshaler.
+//
+// Fields of struct types contribute a segment to the names of their fields'
+// flags, given by their `prefix` tag or, by default, derived from their names.
+// Segments are joined by dots, so the Host field of the DB field of
+//
+//	type Config struct {
+//		DB struct {
+//			Host string
+//		}
+//	}
+//
+// defines the flag "db.host", which is read from the environment variable
+// DB_HOST (or APP_DB_HOST with Prefix("APP_")). The fields of an embedded
+// struct contribute no segment unless it has a `prefix` tag. Each element of
+// a slice of structs contributes its index as a segment after the slice's,
+// as in "servers.0.host"; only the elements present when Struct is called
+// define flags. Pointers to structs are followed, allocating them if nil.
+//
+// The environment variable prefix may be given by an `envprefix` tag on a
+// field of the top-level struct, conventionally a blank marker field:
+//
+//	type Config struct {
+//		_    struct{} `envprefix:"APP_"`
+//		Port int
+//	}
+//
+// A Prefix option given to Struct takes precedence over the tag.
+func Struct(v interface{}, options ...Option) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("envflag: Struct requires a non-nil pointer to a struct")
+	}
+	if prefix, ok := envPrefix(rv.Elem().Type()); ok {
+		options = append([]Option{Prefix(prefix)}, options...)
+	}
+	o := &option{set: flag.CommandLine}
+	for _, opt := range options {
+		opt(o)
+	}
+	keys := make(map[string]string)
+	if err := defineStruct(o.set, rv.Elem(), "", keys); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		options = append([]Option{Names(keys, false)}, options...)
+	}
+	return Parse(options...)
+}
+
+// envPrefix returns the value of the first `envprefix` tag of t's fields.
+func envPrefix(t reflect.Type) (string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if prefix, ok := t.Field(i).Tag.Lookup("envprefix"); ok {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	flagValueType       = reflect.TypeOf((*flag.Value)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// defineStruct defines flags for the fields of v, adding the keys given by
+// their `env` tags to keys.
+func defineStruct(set *flag.FlagSet, v reflect.Value, prefix string, keys map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		fv := v.Field(i)
+		if !sf.IsExported() && !isStruct(fv) {
+			// An unexported embedded value can't be addressed to define a flag.
+			continue
+		}
+		if sf.Anonymous && isStruct(fv) {
+			p := prefix
+			if tag, ok := sf.Tag.Lookup("prefix"); ok {
+				p = joinName(prefix, tag)
+			}
+			if err := defineNested(set, fv, p, keys); err != nil {
+				return err
+			}
+			continue
+		}
+		name := sf.Tag.Get("flag")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = fieldName(sf.Name)
+		}
+		if isStruct(fv) {
+			if tag, ok := sf.Tag.Lookup("prefix"); ok {
+				name = tag
+			}
+			if err := defineNested(set, fv, joinName(prefix, name), keys); err != nil {
+				return err
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Slice && isStruct(reflect.New(fv.Type().Elem()).Elem()) {
+			if tag, ok := sf.Tag.Lookup("prefix"); ok {
+				name = tag
+			}
+			for j := 0; j < fv.Len(); j++ {
+				if err := defineNested(set, fv.Index(j), joinName(prefix, name, strconv.Itoa(j)), keys); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		name = joinName(prefix, name)
+		if err := defineField(set, fv, name, sf.Tag.Get("usage")); err != nil {
+			return fmt.Errorf("envflag: field %s: %v", sf.Name, err)
+		}
+		if key, ok := sf.Tag.Lookup("env"); ok {
+			keys[name] = key
+		}
+	}
+	return nil
+}
+
+// isStruct reports whether v is a struct or a pointer to a struct
+// that should be traversed rather than defined as a flag.
+func isStruct(v reflect.Value) bool {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return !pt.Implements(flagValueType) && !pt.Implements(textUnmarshalerType)
+}
+
+func defineNested(set *flag.FlagSet, v reflect.Value, prefix string, keys map[string]string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return defineStruct(set, v, prefix, keys)
+}
+
+func defineField(set *flag.FlagSet, v reflect.Value, name, usage string) error {
+	p := v.Addr().Interface()
+	switch p := p.(type) {
+	case flag.Value:
+		set.Var(p, name, usage)
+		return nil
+	case encoding.TextUnmarshaler:
+		if m, ok := p.(encoding.TextMarshaler); ok {
+			set.TextVar(p, name, m, usage)
+			return nil
+		}
+	}
+	switch {
+	case v.Type() == durationType:
+		p := p.(*time.Duration)
+		set.DurationVar(p, name, *p, usage)
+		return nil
+	case v.Type().PkgPath() != "":
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	switch p := p.(type) {
+	case *bool:
+		set.BoolVar(p, name, *p, usage)
+	case *int:
+		set.IntVar(p, name, *p, usage)
+	case *int64:
+		set.Int64Var(p, name, *p, usage)
+	case *uint:
+		set.UintVar(p, name, *p, usage)
+	case *uint64:
+		set.Uint64Var(p, name, *p, usage)
+	case *float64:
+		set.Float64Var(p, name, *p, usage)
+	case *string:
+		set.StringVar(p, name, *p, usage)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// fieldName returns the default flag name for a struct field.
+func fieldName(name string) string {
+	return strings.ToLower(strings.Replace(splitWords(name, "-"), "_", "-", -1))
+}
+
+func joinName(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, ".")
+}
@@ -0,0 +1,167 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testDBConfig struct {
+	Host     string
+	MaxConns int `flag:"max"`
+}
+
+type testServer struct {
+	Addr string
+}
+
+type testCommon struct {
+	Verbose bool
+}
+
+type testConfig struct {
+	testCommon
+	Name    string
+	Timeout time.Duration
+	IP      net.IP
+	DB      testDBConfig
+	Cache   *testDBConfig `prefix:"redis"`
+	Servers []testServer
+	List    stringList
+	Skip    string `flag:"-"`
+	skip    string
+}
+
+func TestStruct(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{
+		"APP_VERBOSE=yes",
+		"APP_TIMEOUT=5s",
+		"APP_IP=10.0.0.1",
+		"APP_DB_HOST=db.example.com",
+		"APP_DB_MAX=10",
+		"APP_REDIS_HOST=redis.example.com",
+		"APP_SERVERS_1_ADDR=:8081",
+		"APP_LIST=x",
+		"APP_SKIP=nope",
+	})
+	cfg := testConfig{
+		Name:    "default",
+		Servers: []testServer{{Addr: ":8080"}, {}},
+	}
+	set := flag.NewFlagSet("struct", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	if err := Struct(&cfg, FlagSet(set), Args([]string{"--db.host=override"}), Prefix("APP_")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := testConfig{
+		testCommon: testCommon{Verbose: true},
+		Name:       "default",
+		Timeout:    5 * time.Second,
+		IP:         net.ParseIP("10.0.0.1"),
+		DB:         testDBConfig{Host: "override", MaxConns: 10},
+		Cache:      &testDBConfig{Host: "redis.example.com"},
+		Servers:    []testServer{{Addr: ":8080"}, {Addr: ":8081"}},
+		List:       stringList{"x"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("want: %+v; got: %+v", want, cfg)
+	}
+	var names []string
+	set.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	wantNames := []string{
+		"db.host", "db.max", "ip", "list", "name",
+		"redis.host", "redis.max", "servers.0.addr", "servers.1.addr",
+		"timeout", "verbose",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("names: want: %v; got: %v", wantNames, names)
+	}
+
+	if err := Struct(cfg); err == nil {
+		t.Error("non-pointer: expected error")
+	}
+	bad := struct{ C chan int }{}
+	if err := Struct(&bad, FlagSet(flag.NewFlagSet("bad", flag.ContinueOnError))); err == nil {
+		t.Error("unsupported type: expected error")
+	}
+}
+
+func TestStructEnvPrefix(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"TAG_PORT=1", "OPT_PORT=2"})
+	type config struct {
+		_    struct{} `envprefix:"TAG_"`
+		Port int
+	}
+	for _, tt := range []struct {
+		opts []Option
+		want int
+	}{
+		{want: 1},
+		{opts: []Option{Prefix("OPT_")}, want: 2},
+	} {
+		var cfg config
+		set := flag.NewFlagSet("struct_envprefix", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		if err := Struct(&cfg, append(tt.opts, FlagSet(set), Args(nil))...); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.Port != tt.want {
+			t.Errorf("want: %d; got: %d", tt.want, cfg.Port)
+		}
+	}
+}
+
+type testLevel struct{ v string }
+
+func (l *testLevel) Set(s string) error { l.v = s; return nil }
+func (l *testLevel) String() string     { return l.v }
+
+func TestStructUnexportedValue(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"PORT=1", "TEST_LEVEL=debug"})
+	var cfg struct {
+		testLevel
+		Port int
+	}
+	set := flag.NewFlagSet("struct_unexported", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	if err := Struct(&cfg, FlagSet(set), Args(nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Port != 1 || cfg.v != "" {
+		t.Errorf("unexpected values: port=%d level=%q", cfg.Port, cfg.v)
+	}
+	if f := set.Lookup("test-level"); f != nil {
+		t.Errorf("unexpected flag -%s", f.Name)
+	}
+}
+
+func TestStructTags(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"APP_LOG_LEVEL=debug", "LOG_LEVEL=info", "PREFIX_PORT=1", "DB_URL=postgres://"})
+	var cfg struct {
+		LogLevel string `flag:"log-level" env:"APP_LOG_LEVEL" usage:"logging level"`
+		Port     int    `usage:"listen port"`
+		DB       struct {
+			URL string `env:"DB_URL"`
+		}
+	}
+	set := flag.NewFlagSet("struct_tags", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	if err := Struct(&cfg, FlagSet(set), Args(nil), Prefix("PREFIX_")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogLevel != "debug" || cfg.Port != 1 || cfg.DB.URL != "postgres://" {
+		t.Errorf("unexpected values: %+v", cfg)
+	}
+	for name, want := range map[string]string{"log-level": "logging level", "port": "listen port", "db.url": ""} {
+		if got := set.Lookup(name).Usage; got != want {
+			t.Errorf("%s: usage: want: %q; got: %q", name, want, got)
+		}
+	}
+}
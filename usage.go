@@ -0,0 +1,250 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"weak"
+)
+
+// usageWidth is the width beyond which AnnotateUsage moves an annotation
+// from the end of a flag's usage to a line of its own.
+const usageWidth = 80
+
+// AnnotateUsage returns an Option which wraps the FlagSet's Usage function so
+// that the usage message of each flag shows the environment variable from
+// which Parse reads it, as in "(env: APP_LOG_LEVEL)", respecting options such
+// as Prefix and NameMapper. The annotation follows the last line of the flag's
+// usage if the line would not exceed 80 columns, and otherwise is placed on a
+// line of its own. The wrapped Usage function, or the flag package's default
+// usage message if it is nil, is called with the annotations in place, and
+// they are removed afterwards.
+func AnnotateUsage() Option {
+	return func(o *option) {
+		o.annotateUsage = true
+	}
+}
+
+// A usageWrapper is the Usage function which wrapUsage installs on a FlagSet.
+// It refers to the set weakly, so that the record in usageWrappers doesn't
+// keep the set alive.
+type usageWrapper struct {
+	set      weak.Pointer[flag.FlagSet]
+	usage    func() // the wrapped Usage function
+	keys     map[string]string
+	redact   map[string]bool
+	platform map[string]map[string]string
+}
+
+// usageWrappers records the wrapper installed on each FlagSet, so that parsing
+// a set again reconfigures its wrapper rather than nesting another around it.
+// Entries are removed when their sets are garbage collected.
+var usageWrappers = struct {
+	sync.Mutex
+	m map[weak.Pointer[flag.FlagSet]]*usageWrapper
+}{m: make(map[weak.Pointer[flag.FlagSet]]*usageWrapper)}
+
+// wrapperPC identifies the code of a usageWrapper's show method value, which
+// is shared by every wrapper.
+var wrapperPC = reflect.ValueOf((*usageWrapper)(nil).show).Pointer()
+
+// installedWrapper returns the wrapper installed on set, or nil if its Usage
+// function is not one installed by wrapUsage. The caller must hold the lock
+// of usageWrappers.
+func installedWrapper(set *flag.FlagSet) *usageWrapper {
+	if set.Usage == nil || reflect.ValueOf(set.Usage).Pointer() != wrapperPC {
+		return nil
+	}
+	return usageWrappers.m[weak.Make(set)]
+}
+
+// unwrapUsage returns the Usage function of set with any wrapper installed by
+// wrapUsage removed.
+func unwrapUsage(set *flag.FlagSet) func() {
+	usageWrappers.Lock()
+	defer usageWrappers.Unlock()
+	if w := installedWrapper(set); w != nil {
+		return w.usage
+	}
+	return set.Usage
+}
+
+// wrapUsage wraps the FlagSet's Usage function to annotate the usage of each
+// flag with its key, if AnnotateUsage is given, to show platform defaults, and
+// to redact the default values of flags marked by Redact. If the set is
+// already wrapped, its wrapper is reconfigured instead.
+func (o *option) wrapUsage() {
+	set := o.set
+	keys := make(map[string]string)
+	if o.annotateUsage {
+		set.VisitAll(func(f *flag.Flag) {
+			if k := o.primaryKeys(f.Name); len(k) > 0 {
+				keys[f.Name] = k[0]
+			}
+		})
+	}
+	usageWrappers.Lock()
+	defer usageWrappers.Unlock()
+	if w := installedWrapper(set); w != nil {
+		w.keys, w.redact, w.platform = keys, o.redact, o.platformDefaults
+		return
+	}
+	p := weak.Make(set)
+	if _, ok := usageWrappers.m[p]; !ok {
+		runtime.AddCleanup(set, func(p weak.Pointer[flag.FlagSet]) {
+			usageWrappers.Lock()
+			delete(usageWrappers.m, p)
+			usageWrappers.Unlock()
+		}, p)
+	}
+	w := &usageWrapper{
+		set:      p,
+		usage:    set.Usage,
+		keys:     keys,
+		redact:   o.redact,
+		platform: o.platformDefaults,
+	}
+	usageWrappers.m[p] = w
+	set.Usage = w.show
+}
+
+// show writes the usage message of the wrapper's FlagSet.
+func (w *usageWrapper) show() {
+	set := w.set.Value()
+	if set == nil {
+		return
+	}
+	usageWrappers.Lock()
+	usage, keys, redact, platform := w.usage, w.keys, w.redact, w.platform
+	usageWrappers.Unlock()
+	saved := make(map[*flag.Flag]string)
+	defaults := make(map[*flag.Flag]string)
+	set.VisitAll(func(f *flag.Flag) {
+		def := f.DefValue
+		if d, ok := platform[f.Name][runtime.GOOS]; ok {
+			def = d
+		}
+		if redact[f.Name] && def != "" {
+			def = redacted
+		}
+		if def != f.DefValue {
+			defaults[f] = f.DefValue
+			f.DefValue = def
+		}
+		key, ok := keys[f.Name]
+		note := fmt.Sprintf("(env: %s)", key)
+		if !ok || strings.HasSuffix(f.Usage, note) {
+			return
+		}
+		saved[f] = f.Usage
+		f.Usage = annotate(f, note)
+	})
+	defer func() {
+		for f, u := range saved {
+			f.Usage = u
+		}
+		for f, d := range defaults {
+			f.DefValue = d
+		}
+	}()
+	if usage != nil {
+		usage()
+		return
+	}
+	if set.Name() == "" {
+		fmt.Fprintf(set.Output(), "Usage:\n")
+	} else {
+		fmt.Fprintf(set.Output(), "Usage of %s:\n", set.Name())
+	}
+	set.PrintDefaults()
+}
+
+// annotate returns the usage of f with note appended.
+func annotate(f *flag.Flag, note string) string {
+	if f.Usage == "" {
+		return note
+	}
+	last := f.Usage[strings.LastIndex(f.Usage, "\n")+1:]
+	// PrintDefaults indents usage lines by a tab, which counts as 8 columns,
+	// and may follow the last line with the default value.
+	width := 8 + len(last) + 1 + len(note)
+	if f.DefValue != "" {
+		width += len(fmt.Sprintf(" (default %q)", f.DefValue))
+	}
+	if width > usageWidth {
+		return f.Usage + "\n" + note
+	}
+	return f.Usage + " " + note
+}
+
+// WriteMarkdown writes documentation of the flags to w as a GitHub-flavored
+// Markdown table with one row for each flag, in lexicographical order, giving
+// its name, the environment variable key from which Parse would first read it,
+// as given by EnvKey, its type, its default value, and its usage. The type is
+// the name given in backquotes in the usage, as shown by the flag package's
+// usage message, or else "bool" or "value". The default values of sensitive
+// flags are replaced by "[redacted]". Options which depend on the environment,
+// such as PrefixWhen, have no effect.
+func WriteMarkdown(w io.Writer, options ...Option) error {
+	o := &option{set: flag.CommandLine}
+	for _, opt := range options {
+		opt(o)
+	}
+	if o.err != nil {
+		return o.err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("| Flag | Environment variable | Type | Default | Usage |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- |\n")
+	o.set.VisitAll(func(f *flag.Flag) {
+		key := ""
+		if keys := o.primaryKeys(f.Name); len(keys) > 0 {
+			key = markdownCode(keys[0])
+		}
+		typ, usage := flag.UnquoteUsage(f)
+		switch {
+		case typ == "" && isBoolFlag(f.Value):
+			typ = "bool"
+		case typ == "":
+			typ = "value"
+		}
+		def := o.defValue(f)
+		if o.sensitive(f) {
+			def = redacted
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s |\n",
+			markdownCode("-"+f.Name), key, markdownText(typ), markdownCode(def), markdownText(usage))
+	})
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("envflag: writing markdown: %v", err)
+	}
+	return nil
+}
+
+// markdownText escapes s for a cell of a Markdown table.
+func markdownText(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+// markdownCode formats s as code in a cell of a Markdown table.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	s = strings.Replace(s, "|", `\|`, -1)
+	return fence + strings.Replace(s, "\n", " ", -1) + fence
+}
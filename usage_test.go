@@ -0,0 +1,117 @@
+package envflag
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateUsage(t *testing.T) {
+	defer resetEnv()()
+	set := flag.NewFlagSet("usage", flag.ContinueOnError)
+	var out bytes.Buffer
+	set.SetOutput(&out)
+	set.String("log.level", "info", "log `level`")
+	set.Bool("v", false, "")
+	set.String("description", "", "a very long usage message which leaves no room for the annotation")
+	err := Parse(FlagSet(set), Args([]string{"-h"}), Prefix("APP_"), AnnotateUsage())
+	if err != flag.ErrHelp {
+		t.Fatalf("want: %v; got: %v", flag.ErrHelp, err)
+	}
+	want := `Usage of usage:
+  -description string
+    	a very long usage message which leaves no room for the annotation
+    	(env: APP_DESCRIPTION)
+  -log.level level
+    	log level (env: APP_LOG_LEVEL) (default "info")
+  -v	(env: APP_V)
+`
+	if got := out.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if u := set.Lookup("log.level").Usage; u != "log `level`" {
+		t.Errorf("usage not restored: %q", u)
+	}
+
+	out.Reset()
+	Parse(FlagSet(set), Args([]string{"-h"}), Prefix("APP_"), AnnotateUsage())
+	if n := strings.Count(out.String(), "(env: APP_V)"); n != 1 {
+		t.Errorf("annotations after second Parse: want: 1; got: %d\n%s", n, out.String())
+	}
+}
+
+func TestAnnotateUsageReparse(t *testing.T) {
+	defer resetEnv()()
+	set := flag.NewFlagSet("usage", flag.ContinueOnError)
+	var out bytes.Buffer
+	set.SetOutput(&out)
+	set.String("v", "", "")
+	calls := 0
+	set.Usage = func() {
+		calls++
+		set.PrintDefaults()
+	}
+	check := func(desc, prefix string) {
+		t.Helper()
+		calls = 0
+		out.Reset()
+		set.Usage()
+		if calls != 1 {
+			t.Errorf("%s: usage calls: want: 1; got: %d", desc, calls)
+		}
+		if n := strings.Count(out.String(), "(env: "); n != 1 || !strings.Contains(out.String(), "(env: "+prefix+"V)") {
+			t.Errorf("%s: want one annotation of %sV; got:\n%s", desc, prefix, out.String())
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), AnnotateUsage()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	check("repeated Parse", "APP_")
+	if err := Parse(FlagSet(set), Args(nil), Prefix("NEW_"), AnnotateUsage()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	check("Parse with new options", "NEW_")
+
+	set, err := Reset(set)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls = 0
+	out.Reset()
+	set.Usage()
+	if calls != 1 || strings.Contains(out.String(), "(env: ") {
+		t.Errorf("Reset kept the wrapper: usage calls: %d; output:\n%s", calls, out.String())
+	}
+	if err := Parse(FlagSet(set), Args(nil), Prefix("APP_"), AnnotateUsage()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	check("Parse after Reset", "APP_")
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	set := flag.NewFlagSet("markdown", flag.ContinueOnError)
+	set.String("log.level", "info", "the `level` of logging: debug|info|warn")
+	set.Bool("verbose", false, "verbose output")
+	set.Var(&stringList{}, "tags", "tags\nwith `a|b` syntax")
+	set.String("token", "abc", "API token")
+	set.String("sep", "a|b`", "")
+	var buf bytes.Buffer
+	err := WriteMarkdown(&buf, FlagSet(set), Prefix("APP_"), Redact("token"),
+		StaticMapping(map[string]string{"log.level": "LOG_LEVEL", "sep": "SEP"}, true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "| Flag | Environment variable | Type | Default | Usage |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| `-log.level` | `LOG_LEVEL` | level | `info` | the level of logging: debug\\|info\\|warn |\n" +
+		"| `-sep` | `SEP` | string | `` a\\|b` `` |  |\n" +
+		"| `-tags` | `APP_TAGS` | a\\|b |  | tags<br>with a\\|b syntax |\n" +
+		"| `-token` | `APP_TOKEN` | string | `[redacted]` | API token |\n" +
+		"| `-verbose` | `APP_VERBOSE` | bool | `false` | verbose output |\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
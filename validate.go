@@ -0,0 +1,519 @@
+package envflag
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MutuallyExclusive returns an Option which causes Parse to fail if more than
+// one of the named flags is set to a value other than its default by any
+// source. It may be given more than once to declare separate groups.
+func MutuallyExclusive(names ...string) Option {
+	return func(o *option) {
+		o.exclusive = append(o.exclusive, names)
+	}
+}
+
+func (o *option) checkExclusive() []error {
+	var errs []error
+	for _, names := range o.exclusive {
+		if set := o.nonDefault(names); len(set) > 1 {
+			errs = append(errs, fmt.Errorf("envflag: flags are mutually exclusive: %s", strings.Join(set, ", ")))
+		}
+	}
+	return errs
+}
+
+// RequireExactly returns an Option which causes Parse to fail unless exactly
+// n of the named flags are set to values other than their defaults by any
+// source, such as when exactly one of several authentication methods must be
+// chosen. It may be given more than once to declare separate groups.
+func RequireExactly(n int, names ...string) Option {
+	return func(o *option) {
+		o.exactly = append(o.exactly, exactly{n, names})
+	}
+}
+
+type exactly struct {
+	n     int
+	names []string
+}
+
+func (o *option) checkExactly() []error {
+	var errs []error
+	for _, g := range o.exactly {
+		set := o.nonDefault(g.names)
+		if len(set) == g.n {
+			continue
+		}
+		msg := fmt.Sprintf("envflag: exactly %d of -%s must be set, but %d set", g.n, strings.Join(g.names, ", -"), len(set))
+		if len(set) > 0 {
+			msg += ": " + strings.Join(set, ", ")
+		}
+		errs = append(errs, errors.New(msg))
+	}
+	return errs
+}
+
+// nonDefault returns the named flags whose values differ from their defaults,
+// formatted for use in error messages.
+func (o *option) nonDefault(names []string) []string {
+	var set []string
+	for _, name := range names {
+		if f := o.set.Lookup(name); f != nil && f.Value.String() != o.defValue(f) {
+			set = append(set, "-"+name)
+		}
+	}
+	return set
+}
+
+// AfterSet returns an Option which calls fn with the final value of the named
+// flag once it has been resolved, if it was set by any source. If fn returns
+// an error, Parse fails. Functions are called in the order of their options,
+// after all validation has succeeded, so they may safely act on the value
+// (e.g. by reconfiguring a logger).
+func AfterSet(name string, fn func(value string) error) Option {
+	return func(o *option) {
+		o.afterSet = append(o.afterSet, afterSet{name, fn})
+	}
+}
+
+type afterSet struct {
+	name string
+	fn   func(string) error
+}
+
+func (o *option) runAfterSet() error {
+	for _, h := range o.afterSet {
+		f := o.set.Lookup(h.name)
+		if f == nil || o.sources[h.name] == SourceDefault {
+			continue
+		}
+		if err := h.fn(f.Value.String()); err != nil {
+			return fmt.Errorf("envflag: flag -%s: %v", h.name, err)
+		}
+	}
+	return nil
+}
+
+var typeCheckers = map[string]func(string) error{
+	"bool":     func(s string) error { _, err := strconv.ParseBool(s); return err },
+	"int":      func(s string) error { _, err := strconv.ParseInt(s, 0, strconv.IntSize); return err },
+	"int64":    func(s string) error { _, err := strconv.ParseInt(s, 0, 64); return err },
+	"uint":     func(s string) error { _, err := strconv.ParseUint(s, 0, strconv.IntSize); return err },
+	"uint64":   func(s string) error { _, err := strconv.ParseUint(s, 0, 64); return err },
+	"float64":  func(s string) error { _, err := strconv.ParseFloat(s, 64); return err },
+	"duration": func(s string) error { _, err := time.ParseDuration(s); return err },
+	"string":   func(s string) error { return nil },
+}
+
+// AssertTypes returns an Option which causes Parse to fail if the final value
+// of any flag in types does not parse as the type named by its entry. Valid
+// type names are "bool", "int", "int64", "uint", "uint64", "float64",
+// "duration", and "string". It is a guard for flags registered dynamically,
+// whose types are not evident where they are parsed.
+func AssertTypes(types map[string]string) Option {
+	return func(o *option) {
+		if o.types == nil {
+			o.types = make(map[string]string)
+		}
+		for name, typ := range types {
+			if _, ok := typeCheckers[typ]; !ok && o.err == nil {
+				o.err = fmt.Errorf("envflag: flag -%s: unknown type %q", name, typ)
+			}
+			o.types[name] = typ
+		}
+	}
+}
+
+func (o *option) checkTypes() []error {
+	var errs []error
+	for _, name := range sortedKeys(o.types) {
+		f := o.set.Lookup(name)
+		if f == nil {
+			continue
+		}
+		typ := o.types[name]
+		if err := typeCheckers[typ](f.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: value %q is not a valid %s", name, o.value(f), typ))
+		}
+	}
+	return errs
+}
+
+// Bounds returns an Option which causes Parse to fail if the final value of
+// the named flag is outside the inclusive range [min, max]. The flag must have
+// an integer, float64, or time.Duration value, as reported by its Get method.
+// Durations are compared in nanoseconds, so bounds may be written as, for
+// example, float64(5*time.Second).
+func Bounds(name string, min, max float64) Option {
+	return func(o *option) {
+		o.bounds = append(o.bounds, bounds{name, min, max})
+	}
+}
+
+type bounds struct {
+	name     string
+	min, max float64
+}
+
+func (o *option) checkBounds() []error {
+	var errs []error
+	for _, b := range o.bounds {
+		f := o.set.Lookup(b.name)
+		if f == nil {
+			continue
+		}
+		var n float64
+		format := func(x float64) string { return strconv.FormatFloat(x, 'g', -1, 64) }
+		g, _ := f.Value.(flag.Getter)
+		if g == nil {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: bounds require a numeric value", b.name))
+			continue
+		}
+		switch x := g.Get().(type) {
+		case int:
+			n = float64(x)
+		case int64:
+			n = float64(x)
+		case uint:
+			n = float64(x)
+		case uint64:
+			n = float64(x)
+		case float64:
+			n = x
+		case time.Duration:
+			n = float64(x)
+			format = func(x float64) string { return time.Duration(x).String() }
+		default:
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: bounds require a numeric value", b.name))
+			continue
+		}
+		if n < b.min || n > b.max {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: value %s out of range [%s, %s]", b.name, o.value(f), format(b.min), format(b.max)))
+		}
+	}
+	return errs
+}
+
+// Enum returns an Option which causes Parse to fail if the final value of the
+// named flag, as formatted by its String method, is not one of allowed.
+// The error lists the allowed values.
+func Enum(name string, allowed ...string) Option {
+	return func(o *option) {
+		o.enums = append(o.enums, enum{name, allowed, false})
+	}
+}
+
+// EnumFold returns an Option like Enum, but which compares values
+// case-insensitively.
+func EnumFold(name string, allowed ...string) Option {
+	return func(o *option) {
+		o.enums = append(o.enums, enum{name, allowed, true})
+	}
+}
+
+type enum struct {
+	name    string
+	allowed []string
+	fold    bool
+}
+
+func (o *option) checkEnums() []error {
+	var errs []error
+	for _, e := range o.enums {
+		f := o.set.Lookup(e.name)
+		if f == nil {
+			continue
+		}
+		v := f.Value.String()
+		ok := false
+		for _, a := range e.allowed {
+			if v == a || e.fold && strings.EqualFold(v, a) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("envflag: flag -%s: invalid value %q; allowed: %s", e.name, o.value(f), strings.Join(e.allowed, ", ")))
+		}
+	}
+	return errs
+}
+
+// RequireNonEmpty returns an Option which causes Parse to fail if the final
+// value of any of the named flags, as formatted by its String method, is
+// empty, whether it was set to the empty string or left at an empty default.
+// The error names every such flag.
+func RequireNonEmpty(names ...string) Option {
+	return func(o *option) {
+		o.nonEmpty = append(o.nonEmpty, names...)
+	}
+}
+
+func (o *option) checkNonEmpty() []error {
+	var empty []string
+	for _, name := range o.nonEmpty {
+		if f := o.set.Lookup(name); f != nil && f.Value.String() == "" {
+			empty = append(empty, "-"+name)
+		}
+	}
+	if len(empty) == 0 {
+		return nil
+	}
+	return []error{fmt.Errorf("envflag: flags must not be empty: %s", strings.Join(empty, ", "))}
+}
+
+// ErrorCollector returns an Option which appends every error encountered by
+// Parse to *errs, in addition to returning them joined as a single error.
+// Rather than stopping at the first error, Parse resolves every flag, setting
+// each flag from its source individually rather than re-parsing an argument
+// list, and then runs every validation. Errors come from, in order:
+//
+//   - options, such as Codec with an unknown codec
+//   - the argument list, which stops Parse since the flag package stops
+//     parsing at its first error
+//   - resolving each flag, in order of flag name, such as reading a
+//     LookupSource or decoding a value, and setting it
+//   - validations, such as RequireSource, Bounds, and JSONSchema
+//   - writing reports, such as ProvenanceFile
+//
+// AfterSet callbacks are only run if there are no other errors. Errors
+// setting flags from sources are not written to the FlagSet's output.
+// This is intended for tools, such as configuration linters, which present
+// a complete diagnostic report.
+//
+// AllErrors has the same behavior without collecting the errors.
+func ErrorCollector(errs *[]error) Option {
+	return func(o *option) {
+		o.collector = errs
+	}
+}
+
+// AllErrors returns an Option which causes Parse to report every error, as
+// described for ErrorCollector, in a ParseErrors, rather than failing
+// on the first. Errors setting flags name the environment variable, if any,
+// and the offending value. Without this option, Parse fails fast, in keeping
+// with flag.ContinueOnError.
+func AllErrors() Option {
+	return func(o *option) {
+		o.allErrors = true
+	}
+}
+
+// ParseErrors is the error returned by Parse once flags are resolved, such
+// as for invalid values with AllErrors or for failed validations, listing each
+// failure in the order in which it occurred, so that callers can report them
+// individually. Its message is that of each error on a line of its own, as for
+// errors.Join, and errors.Is and errors.As examine each error, such as an
+// *EnvError for an invalid value from the environment.
+type ParseErrors []error
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors.
+func (e ParseErrors) Unwrap() []error { return e }
+
+// joinErrors returns the non-nil errors as a ParseErrors,
+// or nil if there are none.
+func joinErrors(errs []error) error {
+	var pe ParseErrors
+	for _, err := range errs {
+		if err != nil {
+			pe = append(pe, err)
+		}
+	}
+	if len(pe) == 0 {
+		return nil
+	}
+	return pe
+}
+
+// unjoin returns the errors joined by errors.Join, recursively,
+// or err itself if it was not joined.
+func unjoin(err error) []error {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range j.Unwrap() {
+		errs = append(errs, unjoin(e)...)
+	}
+	return errs
+}
+
+// ValidateConfig returns an Option which calls fn with the FlagSet once all
+// flags are resolved, so that it can check the configuration as a whole, such
+// as that one flag's value is less than another's or that one flag requires
+// another. If fn returns an error, Parse fails with it.
+//
+// Validations run in this order, and Parse reports the errors of all of them:
+// Strict, DetectConflicts, Required, RequireUnlessDefault, RequireSource,
+// RequireNonEmpty, AssertTypes, Bounds, Enum and EnumFold, MutuallyExclusive,
+// RequireExactly, JSONSchema, Validate, and then ValidateConfig, each in the
+// order given. AfterSet callbacks run only once every validation has passed.
+func ValidateConfig(fn func(set *flag.FlagSet) error) Option {
+	return func(o *option) {
+		o.validators = append(o.validators, fn)
+	}
+}
+
+// Validate returns an Option which calls fn with each flag of the FlagSet, in
+// order of flag name, once all flags are resolved, so that it can check the
+// final value of each flag regardless of its source. Errors returned by fn are
+// annotated with the flag's name, and Parse fails with all of them.
+func Validate(fn func(f *flag.Flag) error) Option {
+	return func(o *option) {
+		o.flagValidators = append(o.flagValidators, fn)
+	}
+}
+
+func (o *option) runFlagValidators() []error {
+	var errs []error
+	for _, fn := range o.flagValidators {
+		o.set.VisitAll(func(f *flag.Flag) {
+			if err := fn(f); err != nil {
+				errs = append(errs, fmt.Errorf("envflag: flag -%s: %w", f.Name, err))
+			}
+		})
+	}
+	return errs
+}
+
+func (o *option) runValidators() []error {
+	var errs []error
+	for _, fn := range o.validators {
+		if err := fn(o.set); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Required returns an Option which causes Parse to fail with a *RequiredError
+// if any of the named flags is not set by the argument list or any other
+// source, such as the environment. A flag left at its default value counts as
+// missing, even if the default is not the zero value.
+func Required(names ...string) Option {
+	return func(o *option) {
+		o.required = append(o.required, names...)
+	}
+}
+
+// A RequiredError lists the flags given to Required which were not set.
+type RequiredError struct {
+	Names []string // flag names, in the order given to Required
+}
+
+func (e *RequiredError) Error() string {
+	flags := make([]string, len(e.Names))
+	for i, name := range e.Names {
+		flags[i] = "-" + name
+	}
+	return "envflag: required flags not set: " + strings.Join(flags, ", ")
+}
+
+func (o *option) checkRequired() []error {
+	var missing []string
+	for _, name := range o.required {
+		if o.set.Lookup(name) != nil && o.sources[name] == SourceDefault {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return []error{&RequiredError{Names: missing}}
+}
+
+// Strict returns an Option which causes Parse to fail if an environment
+// variable, including one loaded by EnvFile, has a key starting with the
+// prefix given by Prefix or one of those given by Prefixes, but would not be
+// read by any flag, such as APP_LOG_LEVL with Prefix("APP_"), so that typos
+// are not silently ignored. The error lists the unrecognized keys. Keys read
+// by EnvMap flags and the key given by KillSwitch are recognized. Strict has
+// no effect without a nonempty prefix or when the kill switch is set.
+func Strict() Option {
+	return func(o *option) {
+		o.strict = true
+	}
+}
+
+func (o *option) checkUnknown() []error {
+	if !o.strict || o.disabled() {
+		return nil
+	}
+	var prefixes []string
+	for _, p := range append([]string{o.prefix}, o.prefixes...) {
+		if p != "" {
+			prefixes = append(prefixes, o.joinPrefix(p))
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	known := map[string]bool{o.killKey: true}
+	o.set.VisitAll(func(f *flag.Flag) {
+		for _, key := range o.keys(f.Name) {
+			known[key] = true
+			if o.fileOK(f.Name) {
+				known[o.fileKey(key)] = true
+			}
+			for i := 0; o.indexed[f.Name]; i++ {
+				k := o.indexedKey(key, i)
+				if _, ok := o.lookup(k); !ok {
+					break
+				}
+				known[k] = true
+			}
+		}
+	})
+	keys := make(map[string]bool)
+	for key := range o.environ() {
+		keys[key] = true
+	}
+	for key := range o.fileEnv {
+		keys[key] = true
+	}
+	var unknown []string
+	for _, key := range sortedKeys(keys) {
+		if known[key] || !hasAnyPrefix(key, prefixes) || o.isEnvMapKey(key) {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return []error{fmt.Errorf("envflag: unrecognized environment variables: %s", strings.Join(unknown, ", "))}
+}
+
+// isEnvMapKey reports whether key is read by an EnvMap flag.
+func (o *option) isEnvMapKey(key string) bool {
+	for name, prefix := range o.envMaps {
+		if o.set.Lookup(name) != nil && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
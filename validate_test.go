@@ -0,0 +1,365 @@
+package envflag
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireExactly(t *testing.T) {
+	defer resetEnv()()
+	tests := []struct {
+		args    []string
+		env     []string
+		wantErr string
+	}{
+		{args: []string{"--token=t"}},
+		{env: []string{"CERT=c"}},
+		{wantErr: "envflag: exactly 1 of -token, -cert, -password must be set, but 0 set"},
+		{
+			args:    []string{"--token=t"},
+			env:     []string{"PASSWORD=p"},
+			wantErr: "envflag: exactly 1 of -token, -cert, -password must be set, but 2 set: -token, -password",
+		},
+	}
+	for _, tt := range tests {
+		resetEnv()
+		setEnv(tt.env)
+		set := flag.NewFlagSet("exactly", flag.ContinueOnError)
+		set.String("token", "", "")
+		set.String("cert", "", "")
+		set.String("password", "", "")
+		err := Parse(FlagSet(set), Args(tt.args), RequireExactly(1, "token", "cert", "password"))
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("args=%v env=%v: unexpected error: %v", tt.args, tt.env, err)
+		} else if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("args=%v env=%v: error: want: %q; got: %v", tt.args, tt.env, tt.wantErr, err)
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"POOL=500", "TIMEOUT=-1s", "RATIO=0.5"})
+	set := flag.NewFlagSet("bounds", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("pool", 10, "")
+	set.Duration("timeout", time.Second, "")
+	set.Float64("ratio", 0, "")
+	set.String("name", "", "")
+	err := Parse(FlagSet(set), Args(nil),
+		Bounds("pool", 1, 100),
+		Bounds("timeout", 0, float64(time.Minute)),
+		Bounds("ratio", 0, 1),
+		Bounds("name", 0, 1),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		"envflag: flag -pool: value 500 out of range [1, 100]",
+		"envflag: flag -timeout: value -1s out of range [0s, 1m0s]",
+		"envflag: flag -name: bounds require a numeric value",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error: want: %q; got: %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "-ratio") {
+		t.Errorf("error: unexpected -ratio: %q", err)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"LOG_LEVEL=verbse", "FORMAT=JSON", "MODE=Fast"})
+	set := flag.NewFlagSet("enum", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("log_level", "info", "")
+	set.String("format", "text", "")
+	set.String("mode", "fast", "")
+	err := Parse(FlagSet(set), Args(nil),
+		Enum("log_level", "debug", "info", "warn", "error"),
+		EnumFold("format", "text", "json"),
+		Enum("mode", "fast", "slow"),
+		Bounds("log_level", 0, 1),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`envflag: flag -log_level: invalid value "verbse"; allowed: debug, info, warn, error`,
+		`envflag: flag -mode: invalid value "Fast"; allowed: fast, slow`,
+		"envflag: flag -log_level: bounds require a numeric value",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error: want: %q; got: %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "-format") {
+		t.Errorf("error: unexpected -format: %q", err)
+	}
+}
+
+func TestAfterSet(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"LEVEL=debug"})
+	var calls []string
+	hook := func(name string) func(string) error {
+		return func(v string) error {
+			calls = append(calls, name+"="+v)
+			return nil
+		}
+	}
+	set := flag.NewFlagSet("after_set", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("level", "info", "")
+	set.String("format", "text", "")
+	set.Bool("v", false, "")
+	err := Parse(FlagSet(set), Args([]string{"-v"}),
+		AfterSet("level", hook("level")),
+		AfterSet("format", hook("format")),
+		AfterSet("v", hook("v")),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"level=debug", "v=true"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls: want: %v; got: %v", want, calls)
+	}
+
+	calls = nil
+	set = flag.NewFlagSet("after_set", flag.ContinueOnError)
+	set.String("level", "info", "")
+	set.Bool("a", false, "")
+	set.Bool("b", false, "")
+	err = Parse(FlagSet(set), Args([]string{"-a", "-b"}),
+		MutuallyExclusive("a", "b"),
+		AfterSet("level", hook("level")),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(calls) != 0 {
+		t.Errorf("hook called despite failed validation: %v", calls)
+	}
+
+	set = flag.NewFlagSet("after_set", flag.ContinueOnError)
+	set.String("level", "info", "")
+	err = Parse(FlagSet(set), Args(nil), AfterSet("level", func(string) error { return errors.New("boom") }))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestErrorCollector(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=x", "B=maybe", "C=500", "D=ok", "E=!!"})
+	set := flag.NewFlagSet("error_collector", flag.ContinueOnError)
+	var out bytes.Buffer
+	set.SetOutput(&out)
+	set.Int("a", 0, "")
+	set.Bool("b", false, "")
+	set.Int("c", 0, "")
+	d := set.String("d", "", "")
+	set.String("e", "", "")
+	var errs []error
+	err := Parse(FlagSet(set), Args(nil), ErrorCollector(&errs),
+		Codec("e", "base64"),
+		Bounds("c", 0, 100),
+		RequireNonEmpty("d"),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := []string{
+		`envflag: invalid value "x" for flag -a from A: parse error`,
+		`envflag: invalid value "maybe" for flag -b from B: parse error`,
+		`envflag: flag -e: E: decoding base64:`,
+		`envflag: flag -c: value 500 out of range [0, 100]`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors: want %d; got: %q", len(want), errs)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(errs[i].Error(), w) {
+			t.Errorf("errors[%d]: want: %q; got: %q", i, w, errs[i])
+		}
+		if !strings.Contains(err.Error(), errs[i].Error()) {
+			t.Errorf("returned error missing %q: %q", errs[i], err)
+		}
+	}
+	if *d != "ok" {
+		t.Errorf("d: want: %q; got: %q", "ok", *d)
+	}
+	if out.Len() > 0 {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"START=10", "END=5"})
+	set := flag.NewFlagSet("validate_config", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	start := set.Int("start", 0, "")
+	end := set.Int("end", 0, "")
+	var order []string
+	err := Parse(FlagSet(set), Args(nil),
+		ValidateConfig(func(set *flag.FlagSet) error {
+			order = append(order, "first")
+			if *start > *end {
+				return errors.New("start must not exceed end")
+			}
+			return nil
+		}),
+		ValidateConfig(func(set *flag.FlagSet) error {
+			order = append(order, "second")
+			return nil
+		}),
+		Bounds("end", 6, 100),
+		AfterSet("start", func(string) error {
+			order = append(order, "after")
+			return nil
+		}),
+	)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"start must not exceed end", "envflag: flag -end: value 5 out of range [6, 100]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error: want: %q; got: %q", want, err)
+		}
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order: want: %v; got: %v", want, order)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"ENV=x"})
+	set := flag.NewFlagSet("required", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.String("arg", "", "")
+	set.String("env", "", "")
+	set.String("missing", "", "")
+	set.Int("port", 80, "")
+	err := Parse(FlagSet(set), Args([]string{"-arg=a"}), Required("port", "arg", "env", "missing"))
+	var rerr *RequiredError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("want *RequiredError; got: %v", err)
+	}
+	if want := []string{"port", "missing"}; !reflect.DeepEqual(rerr.Names, want) {
+		t.Errorf("names: want: %v; got: %v", want, rerr.Names)
+	}
+	if want := "envflag: required flags not set: -port, -missing"; rerr.Error() != want {
+		t.Errorf("error: want: %q; got: %q", want, rerr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"B=-1", "C=-2"})
+	set := flag.NewFlagSet("validate", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("c", 0, "")
+	set.Int("a", 0, "")
+	set.Int("b", 0, "")
+	set.Int("d", 0, "")
+	errNegative := errors.New("must not be negative")
+	var visited []string
+	err := Parse(FlagSet(set), Args([]string{"-d=-3"}), Validate(func(f *flag.Flag) error {
+		visited = append(visited, f.Name)
+		if strings.HasPrefix(f.Value.String(), "-") {
+			return errNegative
+		}
+		return nil
+	}))
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("order: want: %v; got: %v", want, visited)
+	}
+	if !errors.Is(err, errNegative) {
+		t.Fatalf("want: %v; got: %v", errNegative, err)
+	}
+	want := "envflag: flag -b: must not be negative\nenvflag: flag -c: must not be negative\nenvflag: flag -d: must not be negative"
+	if err.Error() != want {
+		t.Errorf("error: want: %q; got: %q", want, err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{
+		"APP_LOG_LEVEL=debug", "APP_LOG_LEVL=info", "APP_OLD=x", "APP_CERT_FILE=/dev/null",
+		"APP_TOKEN_FILE=/dev/null", "APP_ENV_A=1", "OTHER_PORT=80", "APP_DISABLE=0",
+	})
+	newSet := func() *flag.FlagSet {
+		set := flag.NewFlagSet("strict", flag.ContinueOnError)
+		set.SetOutput(bytes.NewBuffer(nil))
+		set.String("log.level", "", "")
+		set.String("token", "", "")
+		set.String("cert", "", "")
+		set.Var(&StringMap{}, "env", "")
+		return set
+	}
+	err := Parse(FlagSet(newSet()), Args(nil), Prefix("APP_"), Strict(), KillSwitch("APP_DISABLE"),
+		Aliases(map[string][]string{"token": {"APP_OLD"}}),
+		FileAllowed("token"),
+		EnvMap("env", "APP_ENV_"),
+	)
+	if want := "envflag: unrecognized environment variables: APP_CERT_FILE, APP_LOG_LEVL"; err == nil || err.Error() != want {
+		t.Errorf("error: want: %q; got: %v", want, err)
+	}
+	if err := Parse(FlagSet(newSet()), Args(nil), Strict()); err != nil {
+		t.Errorf("unexpected error without prefix: %v", err)
+	}
+	os.Setenv("APP_DISABLE", "1")
+	if err := Parse(FlagSet(newSet()), Args(nil), Prefix("APP_"), Strict(), KillSwitch("APP_DISABLE")); err != nil {
+		t.Errorf("unexpected error with kill switch: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	defer resetEnv()()
+	setEnv([]string{"A=x", "B=1", "C=y"})
+	set := flag.NewFlagSet("parse_errors", flag.ContinueOnError)
+	set.SetOutput(bytes.NewBuffer(nil))
+	set.Int("a", 0, "")
+	set.Int("b", 0, "")
+	set.Int("c", 0, "")
+	set.String("d", "", "")
+	err := Parse(FlagSet(set), Args(nil), AllErrors(), Required("d"))
+	var pe ParseErrors
+	if !errors.As(err, &pe) {
+		t.Fatalf("want ParseErrors; got: %T: %v", err, err)
+	}
+	if len(pe) != 3 {
+		t.Fatalf("errors: want: 3; got: %d: %v", len(pe), pe)
+	}
+	var keys []string
+	for _, e := range pe {
+		var ee *EnvError
+		if errors.As(e, &ee) {
+			keys = append(keys, ee.EnvKey)
+		}
+	}
+	if want := []string{"A", "C"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys: want: %q; got: %q", want, keys)
+	}
+	want := "envflag: invalid value \"x\" for flag -a from A: parse error\n" +
+		"envflag: invalid value \"y\" for flag -c from C: parse error\n" +
+		"envflag: required flags not set: -d"
+	if err.Error() != want {
+		t.Errorf("message: want: %q; got: %q", want, err)
+	}
+	var ee *EnvError
+	if !errors.As(err, &ee) || ee.Flag != "a" {
+		t.Errorf("want first *EnvError for -a; got: %v", ee)
+	}
+}
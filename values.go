@@ -0,0 +1,438 @@
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// TrimSpace returns an Option which trims leading and trailing whitespace,
+// such as a trailing "\r" from a file edited on Windows, from all environment
+// variable values, so that LOG_LEVEL="info\n" sets a flag to "info". Values
+// passed as command line flags are not trimmed. By default, values are passed
+// to the flag's Set method verbatim, since whitespace may be meaningful to
+// string flags, and a value such as "8080\n" fails to set an int flag.
+func TrimSpace() Option {
+	return func(o *option) {
+		o.trimAll = true
+	}
+}
+
+// TrimFlags returns an Option like TrimSpace, but only for the named flags.
+func TrimFlags(names ...string) Option {
+	return func(o *option) {
+		if o.trim == nil {
+			o.trim = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.trim[name] = true
+		}
+	}
+}
+
+// Transform returns an Option which specifies functions, given by a mapping
+// from flag names to functions, which transform the environment variable
+// values of flags before they're passed to their Set methods, such as to
+// lowercase an enum or to resolve a relative path. A function is applied after
+// inline comments are stripped, variables are expanded, whitespace is
+// trimmed, a SchemeResolver resolves a URL, and a Codec decodes the value,
+// and before the value is checked by RejectLeadingZeros or IntBase. Values
+// passed as command line flags are not transformed. If a function fails,
+// Parse fails with an *EnvError.
+func Transform(m map[string]func(string) (string, error)) Option {
+	return func(o *option) {
+		if o.transforms == nil {
+			o.transforms = make(map[string]func(string) (string, error))
+		}
+		for name, fn := range m {
+			o.transforms[name] = fn
+		}
+	}
+}
+
+// StripInlineComments returns an Option which removes an inline comment,
+// beginning with marker and continuing to the end of the value, from all
+// environment variable values and then trims leading and trailing whitespace,
+// so that "8080 # default" becomes "8080". A marker within a single- or
+// double-quoted section of the value, such as in `"#fff"`, does not begin a
+// comment, and the quotes are kept. If marker is empty, it is "#". Values
+// passed as command line flags are not modified.
+func StripInlineComments(marker string) Option {
+	return func(o *option) {
+		if marker == "" {
+			marker = "#"
+		}
+		o.commentMarker = marker
+	}
+}
+
+// stripComment removes everything from the first unquoted marker in s.
+func stripComment(s, marker string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(s[i:], marker):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// ExpandValues returns an Option which expands references to environment
+// variables, of the form $VAR or ${VAR}, in environment variable values, so
+// that CACHE_DIR=${HOME}/cache is resolved against the environment given by
+// Environment or Cache, or the process environment by default, and then
+// against files given to EnvFile. A reference to an unset variable causes
+// Parse to fail if strict is true and is otherwise kept, in the form ${VAR}.
+// Values passed as command line flags, which a shell has already expanded,
+// are not expanded.
+func ExpandValues(strict bool) Option {
+	return func(o *option) {
+		o.expand = true
+		o.expandStrict = strict
+	}
+}
+
+func (o *option) expandValue(value string) (string, error) {
+	var undefined []string
+	value = os.Expand(value, func(key string) string {
+		if o.interpolate && o.set.Lookup(key) != nil {
+			return "${" + key + "}"
+		}
+		if v, ok := o.lookup(key); ok {
+			return v
+		}
+		if v, ok := o.fileEnv[key]; ok {
+			return v
+		}
+		undefined = append(undefined, key)
+		return "${" + key + "}"
+	})
+	if o.expandStrict && len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variables: %s", strings.Join(undefined, ", "))
+	}
+	return value, nil
+}
+
+// FlagInterpolation returns an Option which replaces references to flags, of
+// the form ${name}, in values from sources other than the argument list with
+// the values of the named flags, so that LISTEN_ADDR=${host}:${port} is
+// resolved against the flags -host and -port, wherever their values came
+// from. Values which reference other flags are resolved after them, and a
+// cycle of references causes Parse to fail. References to names which are not
+// flags are kept, so with ExpandValues they're expanded as variables.
+func FlagInterpolation() Option {
+	return func(o *option) {
+		o.interpolate = true
+	}
+}
+
+var flagRef = regexp.MustCompile(`\$\{[^{}]+\}`)
+
+// interpolateValues replaces references to flags in the resolved values. It
+// records an error for each value in a cycle of references and returns the
+// first.
+func (o *option) interpolateValues(resolved []resolution) error {
+	byName := make(map[string]*resolution)
+	for i := range resolved {
+		if r := &resolved[i]; r.err == nil && r.src != SourceArg && r.src != SourceDefault {
+			byName[r.flag.Name] = r
+		}
+	}
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		r := byName[name]
+		state[name] = visiting
+		path = append(path, name)
+		var err error
+		replace := func(ref string) string {
+			dep := ref[2 : len(ref)-1]
+			f := o.set.Lookup(dep)
+			if f == nil {
+				return ref
+			}
+			d, ok := byName[dep]
+			if !ok {
+				return rawString(f.Value)
+			}
+			switch state[dep] {
+			case visiting:
+				var cycle []string
+				for _, n := range path[indexOf(path, dep):] {
+					cycle = append(cycle, "-"+n)
+				}
+				err = fmt.Errorf("envflag: flag -%s: interpolation cycle: %s -> -%s", name, strings.Join(cycle, " -> "), dep)
+				return ref
+			case 0:
+				visit(dep)
+			}
+			if d.err != nil {
+				if err == nil {
+					err = fmt.Errorf("envflag: flag -%s: references invalid flag -%s", name, dep)
+				}
+				return ref
+			}
+			return d.value
+		}
+		r.value = flagRef.ReplaceAllStringFunc(r.value, replace)
+		for i, v := range r.values {
+			r.values[i] = flagRef.ReplaceAllStringFunc(v, replace)
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		r.err = err
+		return err
+	}
+	var first error
+	for _, name := range sortedKeys(byName) {
+		if state[name] == 0 {
+			if err := visit(name); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func indexOf(s []string, v string) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// RawValues returns an Option which stores in *m the raw value from which
+// each flag was set by the argument list or the environment, before any
+// normalization or transformation and before it is passed to the flag's Set
+// method. Values are recorded even if Set rejects them, so m shows the input
+// that caused an error. Flags left at their default values are omitted.
+func RawValues(m *map[string]string) Option {
+	return func(o *option) {
+		o.raw = m
+	}
+}
+
+// OnEnvSet returns an Option which calls fn for each flag that is about to be
+// set from an environment variable, including one loaded by EnvFile, with the
+// flag's name, the variable's key, and its raw value, before any
+// normalization or transformation, such as that of bool values by BoolValues.
+// It's called before the value is processed and passed to the flag's Set
+// method, so it records the attempt even if either fails. For an EnvMap flag,
+// it's called once for each variable. Functions are called in the order of
+// their options.
+func OnEnvSet(fn func(flagName, envKey, value string)) Option {
+	return func(o *option) {
+		o.onEnvSet = append(o.onEnvSet, fn)
+	}
+}
+
+// envSet calls the OnEnvSet functions.
+func (o *option) envSet(name, key, value string) {
+	for _, fn := range o.onEnvSet {
+		fn(name, key, value)
+	}
+}
+
+// envValue processes the value of an environment variable for the named flag.
+func (o *option) envValue(name, key, value string) (string, error) {
+	if o.commentMarker != "" {
+		value = strings.TrimSpace(stripComment(value, o.commentMarker))
+	}
+	if o.expand {
+		v, err := o.expandValue(value)
+		if err != nil {
+			return "", fmt.Errorf("envflag: flag -%s: %s: %v", name, key, err)
+		}
+		value = v
+	}
+	if o.trimAll || o.trim[name] {
+		value = strings.TrimSpace(value)
+	}
+	if o.schemes != nil {
+		v, err := o.resolveScheme(value)
+		if err != nil {
+			return "", fmt.Errorf("envflag: flag -%s: %s: %v", name, key, err)
+		}
+		value = v
+	}
+	if c, ok := o.codecs[name]; ok {
+		v, err := c.decode(value)
+		if err != nil {
+			return "", fmt.Errorf("envflag: flag -%s: %s: decoding %s: %s", name, key, c.name, o.redactString(name, err.Error(), value))
+		}
+		value = v
+	}
+	if fn, ok := o.transforms[name]; ok {
+		v, err := fn(value)
+		if err != nil {
+			return "", o.envError(name, key, value, err)
+		}
+		value = v
+	}
+	if o.noLeadingZeros[name] && hasLeadingZero(value) {
+		return "", fmt.Errorf("envflag: flag -%s: %s: leading zero in value %s", name, key, o.redactString(name, strconv.Quote(value), strconv.Quote(value)))
+	}
+	if o.intBase[name] {
+		v, err := o.decimal(name, value)
+		if err != nil {
+			return "", fmt.Errorf("envflag: flag -%s: %s: %s", name, key, o.redactString(name, err.Error(), value))
+		}
+		value = v
+	}
+	return value, o.checkEnv(name, key, value)
+}
+
+// PlatformDefault returns an Option which replaces the default value of the
+// named flag with defaults[runtime.GOOS], such as a socket path that differs
+// between operating systems. The flag's registered default is kept if the
+// current GOOS is not in the map. A platform default is used whenever no
+// source sets the flag, including when the flag isn't read from the
+// environment, such as if it's named by ArgsOnly, and it is treated as the
+// flag's default value in usage and validation, though the flag's DefValue is
+// left unchanged.
+func PlatformDefault(name string, defaults map[string]string) Option {
+	return func(o *option) {
+		if o.platformDefaults == nil {
+			o.platformDefaults = make(map[string]map[string]string)
+		}
+		o.platformDefaults[name] = defaults
+	}
+}
+
+// setPlatformDefault applies the platform default for f, if any.
+func (o *option) setPlatformDefault(f *flag.Flag) error {
+	v, ok := o.platformDefaults[f.Name][runtime.GOOS]
+	if !ok {
+		return nil
+	}
+	if err := f.Value.Set(v); err != nil {
+		return fmt.Errorf("envflag: flag -%s: invalid %s default %q: %v", f.Name, runtime.GOOS, v, err)
+	}
+	return nil
+}
+
+// setPlatformDefaults applies the platform defaults of the flags which no
+// source set.
+func (o *option) setPlatformDefaults(collect bool) []error {
+	set := make(map[string]bool)
+	o.set.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var errs []error
+	for _, name := range sortedKeys(o.platformDefaults) {
+		f := o.set.Lookup(name)
+		if f == nil || set[name] {
+			continue
+		}
+		if err := o.setPlatformDefault(f); err != nil {
+			errs = append(errs, err)
+			if !collect {
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// defValue returns the default value of f, which is its platform default, if
+// any, or otherwise its DefValue.
+func (o *option) defValue(f *flag.Flag) string {
+	if v, ok := o.platformDefaults[f.Name][runtime.GOOS]; ok {
+		return v
+	}
+	return f.DefValue
+}
+
+// IntBase returns an Option which normalizes the environment variable values
+// of the named integer flags to decimal before they are passed to the flags'
+// Set methods, so that operators can specify values such as masks and
+// addresses in hexadecimal, octal, or binary even for flags whose values
+// only parse decimal. A value with the prefix "0x", "0o", or "0b" (or "0X",
+// "0O", or "0B"), optionally preceded by a sign and optionally separating
+// digits with underscores, is converted from that base. A value with leading
+// zeros but no such prefix is interpreted as decimal, rather than as octal as
+// the integer flags of the flag package would, so "010" is 10. Any other value
+// is passed unchanged. Values passed as command line flags are not converted.
+func IntBase(names ...string) Option {
+	return func(o *option) {
+		if o.intBase == nil {
+			o.intBase = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.intBase[name] = true
+		}
+	}
+}
+
+// decimal converts an integer value with a base prefix to decimal.
+func (o *option) decimal(name, value string) (string, error) {
+	digits := strings.TrimLeft(value, "+-")
+	if len(digits) < 2 || digits[0] != '0' {
+		return value, nil
+	}
+	base := 0
+	if !strings.ContainsRune("xXoObB", rune(digits[1])) {
+		base = 10
+	}
+	var unsigned bool
+	if f := o.set.Lookup(name); f != nil {
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch g.Get().(type) {
+			case uint, uint64:
+				unsigned = true
+			}
+		}
+	}
+	if unsigned {
+		n, err := strconv.ParseUint(value, base, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid integer %q", value)
+		}
+		return strconv.FormatUint(n, 10), nil
+	}
+	n, err := strconv.ParseInt(value, base, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid integer %q", value)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+// RejectLeadingZeros returns an Option which causes Parse to fail if the
+// environment variable value of any of the named numeric flags has a leading
+// zero followed by another digit, such as "08", which some systems interpret
+// as octal. A bare "0", a decimal fraction such as "0.5", and a base prefix
+// such as "0x" are accepted. Values passed as command line flags are not
+// checked.
+func RejectLeadingZeros(names ...string) Option {
+	return func(o *option) {
+		if o.noLeadingZeros == nil {
+			o.noLeadingZeros = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.noLeadingZeros[name] = true
+		}
+	}
+}
+
+// hasLeadingZero reports whether the number s has a leading zero followed by
+// another digit.
+func hasLeadingZero(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9'
+}
@@ -0,0 +1,162 @@
+package envflag
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+)
+
+var defaultPlaceholder = regexp.MustCompile(`\{\{.*\}\}`)
+
+// WarnPlaceholders returns an Option which warns when an environment variable
+// value matches any of the given patterns, which indicates that a template
+// was not rendered upstream. If no patterns are given, values containing
+// "{{" and "}}" match. The warning names the flag and the offending value.
+// Values passed as command line flags are not checked.
+func WarnPlaceholders(patterns ...*regexp.Regexp) Option {
+	return func(o *option) {
+		o.placeholders = placeholderPatterns(patterns)
+		o.rejectPlaceholders = false
+	}
+}
+
+// RejectPlaceholders returns an Option like WarnPlaceholders, except that
+// matching values cause Parse to fail instead.
+func RejectPlaceholders(patterns ...*regexp.Regexp) Option {
+	return func(o *option) {
+		o.placeholders = placeholderPatterns(patterns)
+		o.rejectPlaceholders = true
+	}
+}
+
+func placeholderPatterns(patterns []*regexp.Regexp) []*regexp.Regexp {
+	if len(patterns) == 0 {
+		return []*regexp.Regexp{defaultPlaceholder}
+	}
+	return patterns
+}
+
+// checkEnv checks the value of an environment variable for the named flag.
+func (o *option) checkEnv(name, key, value string) error {
+	for _, vf := range o.formats[name] {
+		if vf.detect(value) {
+			o.warnf("%s: deprecated value format: %s", key, vf.message)
+		}
+	}
+	for _, re := range o.placeholders {
+		if !re.MatchString(value) {
+			continue
+		}
+		shown := value
+		if f := o.set.Lookup(name); f != nil && o.sensitive(f) {
+			shown = redacted
+		}
+		if o.rejectPlaceholders {
+			return fmt.Errorf("envflag: flag -%s: %s has unrendered placeholder: %q", name, key, shown)
+		}
+		o.warnf("flag -%s: %s has unrendered placeholder: %q", name, key, shown)
+		break
+	}
+	return nil
+}
+
+// WarnLimit returns an Option which limits the number of warnings written by
+// Parse to n. Warnings of every kind, such as those of WarnValueFormat and
+// WarnPlaceholders, count toward the same limit, in the order in which they
+// occur. Once it is reached, further warnings are counted but not written,
+// and a final line reports how many were suppressed.
+func WarnLimit(n int) Option {
+	return func(o *option) {
+		o.warnLimit = n
+		o.warnLimited = true
+	}
+}
+
+// WarnOutput returns an Option which specifies the writer to which Parse
+// writes warnings, such as those of Deprecate and WarnPlaceholders. If unused,
+// they're written to the FlagSet's output.
+func WarnOutput(w io.Writer) Option {
+	return func(o *option) {
+		o.warnOut = w
+	}
+}
+
+// warnOutput returns the writer to which warnings are written.
+func (o *option) warnOutput() io.Writer {
+	if o.warnOut != nil {
+		return o.warnOut
+	}
+	return o.set.Output()
+}
+
+// A Logger receives the messages of Parse, such as warnings of deprecated
+// keys and notices of the sources from which flags are set. Messages don't
+// end with a newline.
+type Logger interface {
+	Warnf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+}
+
+// WithLogger returns an Option which specifies the Logger to which Parse
+// sends its messages, such as one adapting the program's structured logger.
+// Warnings, such as those of Deprecate, WarnPlaceholders, and WarnAliases,
+// are sent to its Warnf method in place of the warning output, subject to
+// WarnLimit. A notice naming the source of each flag set from a source other
+// than the argument list is sent to its Infof method, but never includes the
+// flag's value. If unused, warnings are written to the warning output and
+// notices are discarded.
+func WithLogger(l Logger) Option {
+	return func(o *option) {
+		o.log = l
+	}
+}
+
+// StdLogger returns a Logger which prints messages to l, prefixed by
+// "envflag: warning: " or "envflag: ".
+func StdLogger(l *log.Logger) Logger {
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (l stdLogger) Warnf(format string, args ...interface{}) {
+	l.l.Printf("envflag: warning: "+format, args...)
+}
+
+func (l stdLogger) Infof(format string, args ...interface{}) {
+	l.l.Printf("envflag: "+format, args...)
+}
+
+// warnf writes a warning to the warning output or the Logger.
+func (o *option) warnf(format string, args ...interface{}) {
+	o.warnings++
+	if o.warnLimited && o.warnings > o.warnLimit {
+		return
+	}
+	if o.log != nil {
+		o.log.Warnf(format, args...)
+		return
+	}
+	fmt.Fprintf(o.warnOutput(), "envflag: "+format+"\n", args...)
+}
+
+// infof sends a notice to the Logger, if any.
+func (o *option) infof(format string, args ...interface{}) {
+	if o.log != nil {
+		o.log.Infof(format, args...)
+	}
+}
+
+func (o *option) summarizeWarnings() {
+	n := o.warnings - o.warnLimit
+	switch {
+	case !o.warnLimited || n <= 0:
+	case o.log != nil:
+		o.log.Warnf("...and %d more warnings", n)
+	default:
+		fmt.Fprintf(o.warnOutput(), "envflag: ...and %d more warnings\n", n)
+	}
+}